@@ -0,0 +1,699 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// catalogFileNames are looked for in the workspace root when no catalog file
+// is configured. JSON is read by the YAML parser, as YAML is a superset of it.
+var catalogFileNames = []string{"catalog.yaml", "catalog.yml", "catalog.json"}
+
+// catalogFile is the local description of the Unity Catalog tables, for use
+// without access to the workspace. Names that leave out the catalog or schema
+// are looked up in the defaults, or else anywhere they are unambiguous.
+type catalogFile struct {
+	DefaultCatalog string         `yaml:"default_catalog"`
+	DefaultSchema  string         `yaml:"default_schema"`
+	Catalogs       []catalogEntry `yaml:"catalogs"`
+}
+
+type catalogEntry struct {
+	Name    string        `yaml:"name"`
+	Comment string        `yaml:"comment"`
+	Schemas []schemaEntry `yaml:"schemas"`
+}
+
+type schemaEntry struct {
+	Name    string          `yaml:"name"`
+	Comment string          `yaml:"comment"`
+	Tables  []*catalogTable `yaml:"tables"`
+}
+
+type catalogTable struct {
+	Name    string          `yaml:"name"`
+	Comment string          `yaml:"comment"`
+	Columns []catalogColumn `yaml:"columns"`
+
+	catalog string
+	schema  string
+}
+
+type catalogColumn struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`
+	Comment string `yaml:"comment"`
+}
+
+// catalog is a loaded catalog file, with its tables indexed by their full
+// lower case name.
+type catalog struct {
+	catalogFile
+	path    string
+	modTime time.Time
+	tables  map[string]*catalogTable
+}
+
+// sqlTableRef is a table named after FROM or JOIN, with its alias and the
+// offsets of its name in the SQL.
+type sqlTableRef struct {
+	parts []string
+	alias string
+	start int
+	end   int
+}
+
+// sqlColumnRef is a column qualified by a table name or alias.
+type sqlColumnRef struct {
+	qualifier string
+	column    string
+	start     int
+	end       int
+}
+
+func parseCatalog(data []byte) (*catalog, error) {
+	c := catalog{tables: map[string]*catalogTable{}}
+	if err := yaml.Unmarshal(data, &c.catalogFile); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range c.Catalogs {
+		for _, schema := range entry.Schemas {
+			for _, table := range schema.Tables {
+				if entry.Name == "" || schema.Name == "" || table.Name == "" {
+					return nil, fmt.Errorf("catalog %q has an entry without a name", entry.Name)
+				}
+				table.catalog, table.schema = entry.Name, schema.Name
+				c.tables[strings.ToLower(table.fullName())] = table
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// LoadCatalog reads the catalog file, logging why it could not be read.
+func (s *State) LoadCatalog(logger *log.Logger) {
+	path := s.catalogPath()
+	if path == "" {
+		logger.Printf("No catalog file in %s", s.WorkspaceRoot)
+		return
+	}
+
+	if err := s.loadCatalog(path); err != nil {
+		logger.Printf("Could not load the catalog %s: %s", path, err)
+		return
+	}
+	logger.Printf("Loaded %d tables from %s", len(s.catalog.tables), path)
+}
+
+// currentCatalog returns the catalog, reloading it when the file has changed.
+// A file that no longer parses leaves the last good catalog in place.
+func (s *State) currentCatalog() *catalog {
+	path := s.catalogPath()
+	if path == "" {
+		return nil
+	}
+	s.loadCatalog(path)
+
+	if s.catalog == nil || s.catalog.path != path {
+		return nil
+	}
+	return s.catalog
+}
+
+func (s *State) loadCatalog(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if s.catalog != nil && s.catalog.path == path && s.catalog.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	loaded, err := parseCatalog(data)
+	if err != nil {
+		return err
+	}
+
+	loaded.path, loaded.modTime = path, info.ModTime()
+	s.catalog = loaded
+	return nil
+}
+
+// catalogPath returns the configured catalog file, relative to the workspace
+// root, or the first of the default names that exists.
+func (s *State) catalogPath() string {
+	if s.CatalogFile != "" {
+		if filepath.IsAbs(s.CatalogFile) {
+			return s.CatalogFile
+		}
+		return filepath.Join(s.WorkspaceRoot, s.CatalogFile)
+	}
+
+	if s.WorkspaceRoot == "" {
+		return ""
+	}
+	for _, name := range catalogFileNames {
+		path := filepath.Join(s.WorkspaceRoot, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func (t *catalogTable) fullName() string {
+	return t.catalog + "." + t.schema + "." + t.Name
+}
+
+func (t *catalogTable) column(name string) (catalogColumn, bool) {
+	for _, column := range t.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column, true
+		}
+	}
+	return catalogColumn{}, false
+}
+
+func (t *catalogTable) documentation() string {
+	var doc strings.Builder
+	fmt.Fprintf(&doc, "```sql\n%s\n```", t.fullName())
+	if t.Comment != "" {
+		fmt.Fprintf(&doc, "\n\n%s", t.Comment)
+	}
+
+	if len(t.Columns) > 0 {
+		doc.WriteString("\n\n| Column | Type | Comment |\n| --- | --- | --- |")
+		for _, column := range t.Columns {
+			fmt.Fprintf(&doc, "\n| %s | %s | %s |", column.Name, column.Type, column.Comment)
+		}
+	}
+	return doc.String()
+}
+
+func (column catalogColumn) documentation(table *catalogTable) string {
+	doc := fmt.Sprintf("```sql\n%s %s\n```\n\nColumn of `%s`", column.Name, column.Type, table.fullName())
+	if column.Comment != "" {
+		doc += "\n\n" + column.Comment
+	}
+	return doc
+}
+
+// resolve finds the table a one, two or three part name refers to.
+func (c *catalog) resolve(parts []string) (*catalogTable, bool) {
+	if len(parts) == 0 || len(parts) > 3 {
+		return nil, false
+	}
+
+	name := strings.ToLower(strings.Join(parts, "."))
+	if table, found := c.tables[name]; found {
+		return table, true
+	}
+
+	switch {
+	case len(parts) == 2 && c.DefaultCatalog != "":
+		table, found := c.tables[strings.ToLower(c.DefaultCatalog)+"."+name]
+		return table, found
+	case len(parts) == 1 && c.DefaultCatalog != "" && c.DefaultSchema != "":
+		table, found := c.tables[strings.ToLower(c.DefaultCatalog+"."+c.DefaultSchema)+"."+name]
+		return table, found
+	case len(parts) == 3:
+		return nil, false
+	}
+
+	var match *catalogTable
+	for fullName, table := range c.tables {
+		if strings.HasSuffix(fullName, "."+name) {
+			if match != nil {
+				return nil, false
+			}
+			match = table
+		}
+	}
+	return match, match != nil
+}
+
+// knowsSchema reports whether the catalog lists the schema a qualified name is
+// in, so that a table missing from it is worth reporting. Unqualified names
+// may be temporary views or CTEs and are never reported.
+func (c *catalog) knowsSchema(parts []string) bool {
+	switch len(parts) {
+	case 3:
+		return c.schema(parts[0], parts[1]) != nil
+	case 2:
+		if c.DefaultCatalog != "" {
+			return c.schema(c.DefaultCatalog, parts[0]) != nil
+		}
+		for _, entry := range c.Catalogs {
+			if c.schema(entry.Name, parts[0]) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *catalog) schema(catalogName, schemaName string) *schemaEntry {
+	for _, entry := range c.Catalogs {
+		if !strings.EqualFold(entry.Name, catalogName) {
+			continue
+		}
+		for i := range entry.Schemas {
+			if strings.EqualFold(entry.Schemas[i].Name, schemaName) {
+				return &entry.Schemas[i]
+			}
+		}
+	}
+	return nil
+}
+
+// tableCompletionItems completes the next part of a catalog.schema.table path.
+// The schemas of the default catalog and the tables of the default schema are
+// offered at the top level too.
+func (c *catalog) tableCompletionItems(word string) []lsp.CompletionItem {
+	if c == nil {
+		return nil
+	}
+
+	var qualifier []string
+	if idx := strings.LastIndex(word, "."); idx >= 0 {
+		qualifier = strings.Split(strings.ReplaceAll(word[:idx], "`", ""), ".")
+	}
+
+	var items []lsp.CompletionItem
+	addSchemas := func(entry catalogEntry) {
+		for _, schema := range entry.Schemas {
+			items = append(items, lsp.CompletionItem{Label: schema.Name, Kind: lsp.CompletionItemKindModule, Detail: "schema", Documentation: schema.Comment})
+		}
+	}
+	addTables := func(schema *schemaEntry) {
+		for _, table := range schema.Tables {
+			items = append(items, lsp.CompletionItem{Label: table.Name, Kind: lsp.CompletionItemKindStruct, Detail: "table", Documentation: table.Comment})
+		}
+	}
+
+	switch len(qualifier) {
+	case 0:
+		for _, entry := range c.Catalogs {
+			items = append(items, lsp.CompletionItem{Label: entry.Name, Kind: lsp.CompletionItemKindModule, Detail: "catalog", Documentation: entry.Comment})
+			if strings.EqualFold(entry.Name, c.DefaultCatalog) {
+				addSchemas(entry)
+			}
+		}
+		if schema := c.schema(c.DefaultCatalog, c.DefaultSchema); schema != nil {
+			addTables(schema)
+		}
+	case 1:
+		for _, entry := range c.Catalogs {
+			if strings.EqualFold(entry.Name, qualifier[0]) {
+				addSchemas(entry)
+			}
+		}
+		if schema := c.schema(c.DefaultCatalog, qualifier[0]); schema != nil {
+			addTables(schema)
+		}
+	case 2:
+		if schema := c.schema(qualifier[0], qualifier[1]); schema != nil {
+			addTables(schema)
+		}
+	}
+
+	return items
+}
+
+// columnCompletionItems offers the columns of the tables in a statement. After
+// a table name or alias and a dot, only that table's columns are offered.
+func (c *catalog) columnCompletionItems(statement, word string) ([]lsp.CompletionItem, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	refs, _ := sqlStatementTables(statement)
+
+	var tables []*catalogTable
+	qualified := false
+	if idx := strings.LastIndex(word, "."); idx >= 0 {
+		qualifier := strings.Trim(word[:idx], "`")
+		if strings.Contains(qualifier, ".") {
+			return nil, false
+		}
+		table, found := c.qualifierTable(qualifier, refs)
+		if !found {
+			return nil, false
+		}
+		tables, qualified = []*catalogTable{table}, true
+	} else {
+		for _, ref := range refs {
+			if table, found := c.resolve(ref.parts); found {
+				tables = append(tables, table)
+			}
+		}
+	}
+
+	var items []lsp.CompletionItem
+	seen := map[string]bool{}
+	for _, table := range tables {
+		for _, column := range table.Columns {
+			if seen[strings.ToLower(column.Name)] {
+				continue
+			}
+			seen[strings.ToLower(column.Name)] = true
+			items = append(items, lsp.CompletionItem{
+				Label:         column.Name,
+				Kind:          lsp.CompletionItemKindField,
+				Detail:        fmt.Sprintf("%s · %s", column.Type, table.Name),
+				Documentation: column.Comment,
+			})
+		}
+	}
+
+	return items, qualified
+}
+
+// qualifierTable finds the catalog table that an alias, or the last part of a
+// table name without an alias, stands for in a statement.
+func (c *catalog) qualifierTable(qualifier string, refs []sqlTableRef) (*catalogTable, bool) {
+	for _, ref := range refs {
+		name := ref.alias
+		if name == "" {
+			name = ref.parts[len(ref.parts)-1]
+		}
+		if strings.EqualFold(name, qualifier) {
+			return c.resolve(ref.parts)
+		}
+	}
+	return nil, false
+}
+
+// catalogDocumentation describes the table, alias or column under the cursor
+// in a statement.
+func (c *catalog) catalogDocumentation(line string, character int, statement string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	start, end := sqlNameBounds(line, character)
+	if start == end || strings.HasPrefix(strings.TrimLeft(line[end:], " "), "(") {
+		return "", false
+	}
+	parts := strings.Split(strings.ReplaceAll(line[start:end], "`", ""), ".")
+	index := strings.Count(line[start:min(character, end)], ".")
+	parts = parts[:index+1]
+
+	refs, _ := sqlStatementTables(statement)
+
+	if len(parts) == 2 {
+		if table, found := c.qualifierTable(parts[0], refs); found {
+			if column, found := table.column(parts[1]); found {
+				return column.documentation(table), true
+			}
+		}
+	}
+
+	if table, found := c.resolve(parts); found {
+		return table.documentation(), true
+	}
+
+	if len(parts) == 1 {
+		if table, found := c.qualifierTable(parts[0], refs); found {
+			return table.documentation(), true
+		}
+		for _, ref := range refs {
+			if table, found := c.resolve(ref.parts); found {
+				if column, found := table.column(parts[0]); found {
+					return column.documentation(table), true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// sqlNameBounds returns the bounds of the dotted, possibly quoted name under
+// the cursor.
+func sqlNameBounds(line string, character int) (int, int) {
+	isNameChar := func(char byte) bool {
+		return isWordChar(rune(char)) || char == '.' || char == '`'
+	}
+
+	start := min(character, len(line))
+	for start > 0 && isNameChar(line[start-1]) {
+		start--
+	}
+	end := start
+	for end < len(line) && isNameChar(line[end]) {
+		end++
+	}
+	return start, end
+}
+
+// sqlStatementAt returns the statement around the cursor, given the SQL before
+// and after it.
+func sqlStatementAt(before, after string) string {
+	if idx := strings.LastIndex(before, ";"); idx >= 0 {
+		before = before[idx+1:]
+	}
+	if idx := strings.Index(after, ";"); idx >= 0 {
+		after = after[:idx]
+	}
+	return before + after
+}
+
+// sqlStatementTables lists the tables a statement reads and the columns it
+// qualifies with a table name or alias.
+func sqlStatementTables(sql string) ([]sqlTableRef, []sqlColumnRef) {
+	tokens, err := tokenizeSql(sql)
+	if err != nil {
+		return nil, nil
+	}
+
+	var code []sqlToken
+	for _, token := range tokens {
+		if token.kind != sqlTokenLineComment && token.kind != sqlTokenBlockComment {
+			code = append(code, token)
+		}
+	}
+	return sqlTableRefs(code)
+}
+
+// sqlTableRefs finds the tables named after FROM and JOIN, and the column
+// references outside those names. Table functions and subqueries are skipped,
+// as are the STREAM keyword and Delta versions such as t@v2.
+func sqlTableRefs(tokens []sqlToken) ([]sqlTableRef, []sqlColumnRef) {
+	var tables []sqlTableRef
+	inName := map[int]bool{}
+
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i].text)
+		if tokens[i].kind != sqlTokenWord || (keyword != "from" && keyword != "join") {
+			continue
+		}
+
+		for j := i + 1; j < len(tokens); {
+			if j+1 < len(tokens) && strings.EqualFold(tokens[j].text, "stream") && isSqlIdentifier(tokens[j+1]) {
+				j++
+			}
+			ref, next, ok := sqlTableName(tokens, j)
+			if !ok {
+				break
+			}
+			for k := j; k < next; k++ {
+				inName[k] = true
+			}
+
+			if next+1 < len(tokens) && tokens[next].text == "@" {
+				next += 2
+			}
+
+			if next < len(tokens) && strings.EqualFold(tokens[next].text, "as") {
+				next++
+			}
+			if next < len(tokens) && isSqlAlias(tokens[next]) {
+				ref.alias = strings.Trim(tokens[next].text, "`")
+				next++
+			}
+			tables = append(tables, ref)
+
+			if keyword != "from" || next >= len(tokens) || tokens[next].kind != sqlTokenComma {
+				break
+			}
+			j = next + 1
+		}
+	}
+
+	var columns []sqlColumnRef
+	for i := 0; i+2 < len(tokens); i++ {
+		if inName[i] || !isSqlIdentifier(tokens[i]) || tokens[i+1].kind != sqlTokenDot || !isSqlIdentifier(tokens[i+2]) {
+			continue
+		}
+		if i > 0 && tokens[i-1].kind == sqlTokenDot {
+			continue
+		}
+		if i+3 < len(tokens) && tokens[i+3].kind == sqlTokenOpen {
+			continue
+		}
+		column := tokens[i+2]
+		columns = append(columns, sqlColumnRef{
+			qualifier: strings.Trim(tokens[i].text, "`"),
+			column:    strings.Trim(column.text, "`"),
+			start:     column.offset,
+			end:       column.offset + len(column.text),
+		})
+	}
+
+	return tables, columns
+}
+
+// sqlTableName reads a dotted table name starting at a token, returning the
+// index of the token after it.
+func sqlTableName(tokens []sqlToken, i int) (sqlTableRef, int, bool) {
+	if i >= len(tokens) || !isSqlIdentifier(tokens[i]) || sqlReservedWords[strings.ToLower(tokens[i].text)] {
+		return sqlTableRef{}, i, false
+	}
+
+	ref := sqlTableRef{start: tokens[i].offset}
+	for {
+		ref.parts = append(ref.parts, strings.Trim(tokens[i].text, "`"))
+		ref.end = tokens[i].offset + len(tokens[i].text)
+		i++
+		if i+1 >= len(tokens) || tokens[i].kind != sqlTokenDot || !isSqlIdentifier(tokens[i+1]) {
+			break
+		}
+		i++
+	}
+
+	if i < len(tokens) && tokens[i].kind == sqlTokenOpen {
+		return sqlTableRef{}, i, false
+	}
+	return ref, i, true
+}
+
+func isSqlIdentifier(token sqlToken) bool {
+	return token.kind == sqlTokenWord || (token.kind == sqlTokenLiteral && strings.HasPrefix(token.text, "`"))
+}
+
+// isSqlAlias reports whether a token after a table name is its alias rather
+// than the next keyword. VERSION and TIMESTAMP start time travel clauses.
+func isSqlAlias(token sqlToken) bool {
+	word := strings.ToLower(token.text)
+	return isSqlIdentifier(token) && !sqlReservedWords[word] && word != "version" && word != "timestamp"
+}
+
+// sqlCteNames lists the names a statement's WITH clause defines.
+func sqlCteNames(tokens []sqlToken) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i+2 < len(tokens); i++ {
+		if isSqlIdentifier(tokens[i]) && strings.EqualFold(tokens[i+1].text, "as") && tokens[i+2].kind == sqlTokenOpen {
+			names[strings.ToLower(strings.Trim(tokens[i].text, "`"))] = true
+		}
+	}
+	return names
+}
+
+// catalogMessages warns about tables missing from the catalog and columns
+// missing from their table in %sql cells. Only tables in a schema the catalog
+// lists, and columns qualified by a table the catalog knows, are checked.
+func catalogMessages(doc string, c *catalog, defined map[string]bool) []errorMessage {
+	var messages []errorMessage
+
+	for _, cell := range splitIntoSQLCells(doc) {
+		source := cell.sqlSource()
+		tokens, err := tokenizeSql(strings.Join(source, "\n"))
+		if err != nil {
+			continue
+		}
+
+		report := func(start, end int, code, desc string) {
+			startPos := cell.sourcePosition(source, start)
+			endPos := cell.sourcePosition(source, end)
+			messages = append(messages, errorMessage{
+				line:     startPos.Line + 1,
+				char:     startPos.Character + 1,
+				endLine:  endPos.Line + 1,
+				endChar:  endPos.Character + 1,
+				code:     code,
+				desc:     desc,
+				source:   "catalog",
+				severity: 2,
+			})
+		}
+
+		for _, statement := range splitSqlStatements(tokens) {
+			ctes := sqlCteNames(statement)
+			tables, columns := sqlTableRefs(statement)
+
+			// Tables created by the notebooks may differ from the catalog.
+			var cataloged []sqlTableRef
+			for _, ref := range tables {
+				name := strings.ToLower(strings.Join(ref.parts, "."))
+				if defined[name] || ctes[name] {
+					continue
+				}
+				cataloged = append(cataloged, ref)
+
+				if _, found := c.resolve(ref.parts); !found && c.knowsSchema(ref.parts) {
+					report(ref.start, ref.end, "unknown-table", fmt.Sprintf("Table `%s` is not in the catalog", strings.Join(ref.parts, ".")))
+				}
+			}
+
+			for _, ref := range columns {
+				table, found := c.qualifierTable(ref.qualifier, cataloged)
+				if !found || len(table.Columns) == 0 {
+					continue
+				}
+				if _, found := table.column(ref.column); !found {
+					report(ref.start, ref.end, "unknown-column", fmt.Sprintf("Column `%s` is not in `%s`", ref.column, table.fullName()))
+				}
+			}
+		}
+	}
+
+	return messages
+}
+
+// splitSqlStatements splits tokens on semicolons, leaving out comments.
+func splitSqlStatements(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	var current []sqlToken
+
+	for _, token := range tokens {
+		switch token.kind {
+		case sqlTokenLineComment, sqlTokenBlockComment:
+		case sqlTokenSemicolon:
+			statements = append(statements, current)
+			current = nil
+		default:
+			current = append(current, token)
+		}
+	}
+	return append(statements, current)
+}
+
+// sortedCompletionItems orders items by label, dropping repeated labels.
+func sortedCompletionItems(items []lsp.CompletionItem) []lsp.CompletionItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+
+	var unique []lsp.CompletionItem
+	for i, item := range items {
+		if i == 0 || item.Label != items[i-1].Label {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const catalogYaml = `default_catalog: main
+catalogs:
+  - name: main
+    schemas:
+      - name: sales
+        tables:
+          - name: orders
+            comment: One row per order
+            columns:
+              - {name: order_id, type: bigint}
+              - {name: customer_id, type: bigint}
+              - {name: amount, type: "decimal(10,2)", comment: Order total}
+          - name: customers
+            columns:
+              - {name: customer_id, type: bigint}
+              - {name: name, type: string}
+`
+
+const catalogNotebook = `# Databricks notebook source
+# MAGIC %sql
+# MAGIC SELECT o.amount, o.total, c.name
+# MAGIC FROM sales.orders o JOIN main.sales.customer c ON o.customer_id = c.customer_id
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC CREATE OR REPLACE TEMP VIEW sales.recent AS SELECT 1 AS id;
+# MAGIC SELECT r.id FROM sales.recent r, main.sales.orders`
+
+func newCatalogState(t *testing.T) State {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "catalog.yaml"), []byte(catalogYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state := NewState()
+	state.WorkspaceRoot = root
+	state.LoadCatalog(log.New(os.Stderr, "", 0))
+	if state.catalog == nil {
+		t.Fatal("Expected the catalog to load")
+	}
+	return state
+}
+
+func TestCatalogMessages(t *testing.T) {
+	state := newCatalogState(t)
+	state.OpenDocument("file:///nb.py", catalogNotebook)
+
+	messages := catalogMessages(catalogNotebook, state.currentCatalog(), state.definedTableNames())
+	expected := []struct {
+		line, char int
+		desc       string
+	}{
+		{3, 33, "Table `main.sales.customer` is not in the catalog"},
+		{2, 27, "Column `total` is not in `main.sales.orders`"},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, Got: %+v", len(expected), messages)
+	}
+	for i, e := range expected {
+		if messages[i].line != e.line+1 || messages[i].char != e.char+1 || messages[i].desc != e.desc {
+			t.Fatalf("Expected %q at %d:%d, Got: %+v", e.desc, e.line, e.char, messages[i])
+		}
+	}
+}
+
+func TestCatalogCompletion(t *testing.T) {
+	state := newCatalogState(t)
+	logger := log.New(os.Stderr, "", 0)
+
+	doc := "# Databricks notebook source\n# MAGIC %sql\n# MAGIC SELECT o. FROM sales.orders o JOIN main.sales."
+	state.OpenDocument("file:///nb.py", doc)
+
+	labels := func(items []lsp.CompletionItem) string {
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return strings.Join(names, ",")
+	}
+
+	columns := state.Completion(1, "file:///nb.py", lsp.Position{Line: 2, Character: 17}, logger).Result
+	if got := labels(columns); got != "order_id,customer_id,amount" {
+		t.Fatalf("Expected the columns of orders, Got: %s", got)
+	}
+
+	tables := state.Completion(1, "file:///nb.py", lsp.Position{Line: 2, Character: 54}, logger).Result
+	if got := labels(tables); got != "customers,orders" {
+		t.Fatalf("Expected the tables of main.sales, Got: %s", got)
+	}
+}
+
+func TestCatalogHover(t *testing.T) {
+	state := newCatalogState(t)
+	logger := log.New(os.Stderr, "", 0)
+	state.OpenDocument("file:///nb.py", catalogNotebook)
+
+	table := state.Hover(1, "file:///nb.py", lsp.Position{Line: 3, Character: 21}, logger)
+	if table.Result == nil || !strings.HasPrefix(table.Result.Contents.Value, "```sql\nmain.sales.orders\n```\n\nOne row per order") {
+		t.Fatalf("Expected the orders table, Got: %+v", table.Result)
+	}
+
+	column := state.Hover(1, "file:///nb.py", lsp.Position{Line: 2, Character: 17}, logger)
+	if column.Result == nil || !strings.HasPrefix(column.Result.Contents.Value, "```sql\namount decimal(10,2)\n```") {
+		t.Fatalf("Expected the amount column, Got: %+v", column.Result)
+	}
+}
@@ -0,0 +1,121 @@
+package analysis
+
+import "strings"
+
+const (
+	notebookHeader   = "# databricks notebook source"
+	commandSeparator = "# command ----------"
+	magicPrefix      = "# magic"
+	titlePrefix      = "# dbtitle"
+)
+
+// cell is a single Databricks cell, the lines between two
+// "# COMMAND ----------" separators.
+type cell struct {
+	language  string
+	title     string
+	startLine int
+	lines     []string
+}
+
+func isNotebook(doc string) bool {
+	return strings.Contains(strings.ToLower(doc), notebookHeader)
+}
+
+func isCommandSeparator(line string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), commandSeparator)
+}
+
+func isTitleLine(line string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), titlePrefix)
+}
+
+func isHeaderLine(line string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), notebookHeader)
+}
+
+// magicContent strips the "# MAGIC " prefix from a line, returning the
+// remaining text and the column it starts at.
+func magicContent(line string) (string, int, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasPrefix(strings.ToLower(line), magicPrefix) {
+		return line, 0, false
+	}
+
+	rest := line[len(magicPrefix):]
+	if strings.HasPrefix(rest, " ") {
+		return rest[1:], len(magicPrefix) + 1, true
+	}
+	return rest, len(magicPrefix), true
+}
+
+// splitIntoCells splits a notebook into its cells, keeping the original text.
+// The separator lines themselves are not part of any cell.
+func splitIntoCells(doc string) []cell {
+	var cells []cell
+	current := cell{}
+
+	for i, line := range splitCellIntoLines(doc) {
+		if isCommandSeparator(line) {
+			cells = append(cells, finishCell(current))
+			current = cell{startLine: i + 1}
+			continue
+		}
+		current.lines = append(current.lines, line)
+	}
+
+	return append(cells, finishCell(current))
+}
+
+func finishCell(c cell) cell {
+	c.language = "python"
+
+	for _, line := range c.lines {
+		if strings.TrimSpace(line) == "" || isHeaderLine(line) {
+			continue
+		}
+
+		if isTitleLine(line) {
+			_, title, found := strings.Cut(line, ",")
+			if found {
+				c.title = strings.TrimSpace(title)
+			}
+			continue
+		}
+
+		content, _, isMagic := magicContent(line)
+		content = strings.TrimSpace(content)
+		if isMagic && strings.HasPrefix(content, "%") {
+			c.language = strings.ToLower(strings.Fields(content)[0][1:])
+		}
+		break
+	}
+
+	return c
+}
+
+// source returns the cell lines with the "# MAGIC " prefixes removed. Lines
+// that are not magic lines are left empty so that line numbers still match.
+func (c cell) source() []string {
+	var lines []string
+
+	for _, line := range c.lines {
+		content, _, isMagic := magicContent(line)
+		if !isMagic {
+			content = ""
+		}
+		lines = append(lines, content)
+	}
+
+	return lines
+}
+
+// cellAt returns the cell holding a line of a notebook.
+func cellAt(doc string, line int) (cell, bool) {
+	for _, c := range splitIntoCells(doc) {
+		if line >= c.startLine && line < c.startLine+len(c.lines) {
+			return c, true
+		}
+	}
+	return cell{}, false
+}
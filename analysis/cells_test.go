@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"encoding/json"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+func TestSplitIntoCells(t *testing.T) {
+	doc := "# Databricks notebook source\nimport os\n\n# COMMAND ----------\n\n# DBTITLE 1,Load orders\n# MAGIC %sql\n# MAGIC SELECT 1\n\n# COMMAND ----------\n\n# MAGIC %md\n# MAGIC # Title"
+
+	cells := splitIntoCells(doc)
+	if len(cells) != 3 {
+		t.Fatalf("Expected 3 cells, Got: %d", len(cells))
+	}
+
+	expected := []cell{
+		{language: "python", startLine: 0},
+		{language: "sql", title: "Load orders", startLine: 4},
+		{language: "md", startLine: 10},
+	}
+	for i, c := range cells {
+		if c.language != expected[i].language || c.title != expected[i].title || c.startLine != expected[i].startLine {
+			t.Fatalf("Expected: %+v, Got: %+v", expected[i], c)
+		}
+	}
+
+	if cells[1].lines[3] != "# MAGIC SELECT 1" {
+		t.Fatalf("Expected original text, Got: %s", cells[1].lines[3])
+	}
+}
+
+func TestSemanticFormatMagicCells(t *testing.T) {
+	doc := "# Databricks notebook source\n# COMMAND ----------\n# MAGIC %md\n# MAGIC ## Heading\n# MAGIC a **bold** word"
+
+	state := NewState()
+	state.OpenDocument("file:///nb.py", doc)
+	response := state.SemanticFormat(1, "file:///nb.py", log.New(os.Stderr, "", 0))
+
+	// line, start, length, type for each token in absolute positions
+	expected := [][]int{
+		{0, 0, 28, lsp.TokenComment},
+		{1, 0, 20, lsp.TokenComment},
+		{2, 0, 7, lsp.TokenComment},
+		{2, 8, 3, lsp.TokenMacro},
+		{3, 0, 7, lsp.TokenComment},
+		{3, 8, 10, lsp.TokenMarkdownHeading},
+		{4, 0, 7, lsp.TokenComment},
+		{4, 10, 8, lsp.TokenMarkdownEmphasis},
+	}
+
+	data := response.Result.Data
+	if len(data) != len(expected)*5 {
+		t.Fatalf("Expected %d tokens, Got: %v", len(expected), data)
+	}
+
+	line, start := 0, 0
+	for i, e := range expected {
+		if data[i*5] != 0 {
+			start = 0
+		}
+		line += int(data[i*5])
+		start += int(data[i*5+1])
+		actual := []int{line, start, int(data[i*5+2]), int(data[i*5+3])}
+		for j := range e {
+			if actual[j] != e[j] {
+				t.Fatalf("Token %d: Expected: %v, Got: %v", i, e, actual)
+			}
+		}
+	}
+}
+
+func TestClassifySqlWordIgnoresCase(t *testing.T) {
+	cases := map[string]int{
+		"SELECT":   lsp.TokenProperty,
+		"select":   lsp.TokenProperty,
+		"Date_Add": lsp.TokenMethod,
+		"orders":   lsp.TokenNamespace,
+	}
+	for word, expected := range cases {
+		if actual := classifySqlWord(word); actual != expected {
+			t.Fatalf("%s: Expected: %d, Got: %d", word, expected, actual)
+		}
+	}
+}
+
+func TestSemanticFormatWithoutTokens(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///script.py", "print(1)\n")
+
+	data, err := json.Marshal(state.SemanticFormat(1, "file:///script.py", log.New(os.Stderr, "", 0)).Result)
+	if err != nil || string(data) != `{"data":[]}` {
+		t.Fatalf("Expected an empty data array, Got: %s", data)
+	}
+}
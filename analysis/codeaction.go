@@ -0,0 +1,243 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+const (
+	codeActionKindRuffFixAll          = lsp.CodeActionKindSourceFixAll + ".ruff"
+	codeActionKindRuffOrganizeImports = lsp.CodeActionKindSourceOrganizeImports + ".ruff"
+)
+
+// organizeImportsRule is ruff's import sorting rule. Linting runs it apart
+// from the configured rules and keeps its fixes for the organize imports
+// action.
+const organizeImportsRule = "I001"
+
+func (s *State) CodeActions(id int, params lsp.CodeActionParams, logger *log.Logger) *lsp.CodeActionResponse {
+
+	actions := []lsp.CodeAction{}
+
+	uri := params.TextDocument.URI
+	doc := s.Documents[uri]
+
+	if isNotebook(doc) {
+		lines := splitCellIntoLines(doc)
+
+		var fixable []errorMessage
+		for _, msg := range s.reportedMessages(uri) {
+			canFix := msg.fix != nil && !msg.fix.crossesCell(lines)
+			if canFix {
+				fixable = append(fixable, msg)
+			}
+
+			if !msg.overlaps(params.Range) {
+				continue
+			}
+			if canFix {
+				actions = append(actions, lsp.CodeAction{
+					Title:       msg.fix.title,
+					Kind:        lsp.CodeActionKindQuickFix,
+					Diagnostics: []lsp.Diagnostic{msg.diagnostic()},
+					IsPreferred: msg.fix.applicability == "safe",
+					Edit:        workspaceEdit(uri, msg.fix.edits),
+				})
+			}
+			if action, ok := suppressAction(uri, doc, msg); ok {
+				actions = append(actions, action)
+			}
+		}
+
+		if edits := combineSafeFixes(fixable); len(edits) > 0 {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Fix all auto-fixable problems",
+				Kind:  codeActionKindRuffFixAll,
+				Edit:  workspaceEdit(uri, edits),
+			})
+		}
+
+		if codeActionWanted(codeActionKindRuffOrganizeImports, params.Context.Only) {
+			edits, err := s.organizeImportsEdits(uri, lines, organizeImportsRequested(params.Context.Only))
+			if err != nil {
+				logger.Printf("Error organising imports: %s", err)
+			} else if len(edits) > 0 {
+				actions = append(actions, lsp.CodeAction{
+					Title: "Organize imports",
+					Kind:  codeActionKindRuffOrganizeImports,
+					Edit:  workspaceEdit(uri, edits),
+				})
+			}
+		}
+	}
+
+	var wanted []lsp.CodeAction
+	for _, action := range actions {
+		if codeActionWanted(action.Kind, params.Context.Only) {
+			wanted = append(wanted, action)
+		}
+	}
+	logger.Printf("Offering %d code actions", len(wanted))
+
+	response := lsp.CodeActionResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: append([]lsp.CodeAction{}, wanted...),
+	}
+
+	return &response
+}
+
+// codeActionWanted reports whether a kind of action was asked for. Kinds are
+// hierarchical, so asking for "source" includes "source.fixAll.ruff".
+func codeActionWanted(kind string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(kind, requested+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// organizeImportsRequested reports whether organize imports was asked for by
+// kind, rather than as one of all the actions at the cursor.
+func organizeImportsRequested(only []string) bool {
+	for _, requested := range only {
+		if strings.HasPrefix(requested, lsp.CodeActionKindSourceOrganizeImports) {
+			return true
+		}
+	}
+	return false
+}
+
+// organizeImportsEdits returns ruff's import sorting fixes as edits of the
+// document. Ruff only runs again when the action is asked for by kind; the
+// actions offered at the cursor, asked for on every move, use the fixes found
+// by the last lint.
+func (s *State) organizeImportsEdits(uri string, lines []string, rerun bool) ([]lintEdit, error) {
+	messages := s.importFixes[uri]
+	if rerun {
+		var err error
+		if messages, err = s.organizeImportsMessages(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	var edits []lintEdit
+	for _, msg := range messages {
+		if msg.fix != nil && !msg.fix.crossesCell(lines) {
+			edits = append(edits, msg.fix.edits...)
+		}
+	}
+
+	return edits, nil
+}
+
+// organizeImportsMessages runs ruff's import sorting on the lint file.
+func (s *State) organizeImportsMessages(uri string) ([]errorMessage, error) {
+	execPath, err := exec.LookPath("ruff")
+	if err != nil {
+		return nil, err
+	}
+
+	lintFile := fmt.Sprintf("%s.temp_%s", GetTempPath(), GetTempFileName(uri))
+	output, err := getLintedResults(execPath, lintFile, "--select", organizeImportsRule)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := parseRuffResults(output)
+	if err != nil {
+		return nil, err
+	}
+	return mapLintLines(messages, s.LintLineMaps[uri]), nil
+}
+
+// crossesCell reports whether a fix would edit a cell separator, which would
+// merge or move cells. Ruff sees a notebook as a single file, so import
+// sorting in particular can reach across cells.
+func (fix *lintFix) crossesCell(lines []string) bool {
+	for _, edit := range fix.edits {
+		if strings.Contains(strings.ToLower(edit.content), commandSeparator) {
+			return true
+		}
+
+		last := edit.endLine
+		if edit.endChar == 1 {
+			last--
+		}
+		for line := edit.line; line <= last && line <= len(lines); line++ {
+			if line >= 1 && isCommandSeparator(lines[line-1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (msg errorMessage) overlaps(r lsp.Range) bool {
+	msgRange := msg.lspRange()
+	return !positionBefore(msgRange.EndPosition, r.StartPosition) && !positionBefore(r.EndPosition, msgRange.StartPosition)
+}
+
+func positionBefore(a, b lsp.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// combineSafeFixes merges the safe fixes of several messages, skipping any
+// fix that overlaps one already taken, as ruff would on its next pass.
+func combineSafeFixes(messages []errorMessage) []lintEdit {
+	var fixes []*lintFix
+	for _, msg := range messages {
+		if msg.fix.applicability == "safe" {
+			fixes = append(fixes, msg.fix)
+		}
+	}
+
+	sort.SliceStable(fixes, func(i, j int) bool {
+		return positionBefore(fixes[i].edits[0].start(), fixes[j].edits[0].start())
+	})
+
+	var edits []lintEdit
+	lastEnd := lsp.Position{Line: -1}
+	for _, fix := range fixes {
+		if positionBefore(fix.edits[0].start(), lastEnd) {
+			continue
+		}
+		edits = append(edits, fix.edits...)
+		lastEnd = fix.edits[len(fix.edits)-1].end()
+	}
+
+	return edits
+}
+
+func (edit lintEdit) start() lsp.Position {
+	return lsp.Position{Line: edit.line - 1, Character: edit.char - 1}
+}
+
+func (edit lintEdit) end() lsp.Position {
+	return lsp.Position{Line: edit.endLine - 1, Character: edit.endChar - 1}
+}
+
+func workspaceEdit(uri string, edits []lintEdit) *lsp.WorkspaceEdit {
+	var textEdits []lsp.TextEdit
+	for _, edit := range edits {
+		textEdits = append(textEdits, lsp.TextEdit{
+			Range:   lsp.Range{StartPosition: edit.start(), EndPosition: edit.end()},
+			NewText: edit.content,
+		})
+	}
+
+	return &lsp.WorkspaceEdit{
+		Changes: map[string][]lsp.TextEdit{uri: textEdits},
+	}
+}
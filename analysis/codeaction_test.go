@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const fixableNotebook = `# Databricks notebook source
+import os
+import sys
+
+# COMMAND ----------
+
+print(sys.path)
+`
+
+const fixableRuffOutput = `[
+  {
+    "code": "F401",
+    "message": "` + "`os`" + ` imported but unused",
+    "location": {"row": 2, "column": 8},
+    "end_location": {"row": 2, "column": 10},
+    "url": "https://docs.astral.sh/ruff/rules/unused-import",
+    "fix": {
+      "applicability": "safe",
+      "message": "Remove unused import: ` + "`os`" + `",
+      "edits": [{"content": "", "location": {"row": 2, "column": 1}, "end_location": {"row": 3, "column": 1}}]
+    }
+  },
+  {
+    "code": "F401",
+    "message": "` + "`sys`" + ` imported but unused",
+    "location": {"row": 3, "column": 8},
+    "end_location": {"row": 3, "column": 11},
+    "url": null,
+    "fix": {
+      "applicability": "safe",
+      "message": "Remove unused import",
+      "edits": [{"content": "", "location": {"row": 3, "column": 1}, "end_location": {"row": 6, "column": 1}}]
+    }
+  }
+]`
+
+func TestCodeActionsForRuffFixes(t *testing.T) {
+	messages, err := parseRuffResults(fixableRuffOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := NewState()
+	state.OpenDocument("file:///nb.py", fixableNotebook)
+	state.LinterResults["file:///nb.py"] = messages
+
+	params := lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: "file:///nb.py"},
+		Range:        lsp.Range{StartPosition: lsp.Position{Line: 1, Character: 8}, EndPosition: lsp.Position{Line: 1, Character: 8}},
+		Context:      lsp.CodeActionContext{Only: []string{lsp.CodeActionKindQuickFix, lsp.CodeActionKindSourceFixAll}},
+	}
+	actions := state.CodeActions(1, params, log.New(os.Stderr, "", 0)).Result
+
+	if len(actions) != 3 {
+		t.Fatalf("Expected a quick fix, a suppression and a fix all action, Got: %+v", actions)
+	}
+	if actions[0].Title != "Remove unused import: `os`" || !actions[0].IsPreferred || len(actions[0].Diagnostics) != 1 {
+		t.Fatalf("Expected the os quick fix, Got: %+v", actions[0])
+	}
+	edit := actions[0].Edit.Changes["file:///nb.py"][0]
+	if edit.Range.StartPosition != (lsp.Position{Line: 1}) || edit.Range.EndPosition != (lsp.Position{Line: 2}) {
+		t.Fatalf("Expected the edit to remove line 1, Got: %+v", edit)
+	}
+
+	// The sys fix removes the cell separator, so only the os fix is combined.
+	if edits := actions[2].Edit.Changes["file:///nb.py"]; actions[2].Kind != "source.fixAll.ruff" || len(edits) != 1 {
+		t.Fatalf("Expected fix all to skip the fix across cells, Got: %+v", actions[2])
+	}
+}
+
+func TestOrganizeImportsFromLastLint(t *testing.T) {
+	messages, err := parseRuffResults(`[{
+    "code": "I001",
+    "message": "Import block is un-sorted or un-formatted",
+    "location": {"row": 2, "column": 1},
+    "end_location": {"row": 4, "column": 1},
+    "url": null,
+    "fix": {"applicability": "safe", "message": "Organize imports", "edits": [{"content": "import os\nimport sys\n", "location": {"row": 2, "column": 1}, "end_location": {"row": 4, "column": 1}}]}
+  }]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := NewState()
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\nimport sys\nimport os\n")
+	state.importFixes["file:///nb.py"] = messages
+
+	params := lsp.CodeActionParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///nb.py"}}
+	actions := state.CodeActions(1, params, log.New(os.Stderr, "", 0)).Result
+	if len(actions) != 1 || actions[0].Kind != "source.organizeImports.ruff" || actions[0].Edit.Changes["file:///nb.py"][0].NewText != "import os\nimport sys\n" {
+		t.Fatalf("Expected organize imports from the last lint, Got: %+v", actions)
+	}
+
+	if !organizeImportsRequested([]string{lsp.CodeActionKindSourceOrganizeImports}) || organizeImportsRequested(nil) || organizeImportsRequested([]string{"source"}) {
+		t.Fatal("Expected ruff to run again only when organize imports is asked for by kind")
+	}
+}
+
+func TestLintKeepsConfiguredImportSorting(t *testing.T) {
+	dir := t.TempDir()
+	unsorted := `[{"code": "I001", "message": "Import block is un-sorted or un-formatted", "location": {"row": 2, "column": 1}, "end_location": {"row": 4, "column": 1}, "url": null,
+  "fix": {"applicability": "safe", "message": "Organize imports", "edits": [{"content": "import os\nimport sys\n", "location": {"row": 2, "column": 1}, "end_location": {"row": 4, "column": 1}}]}}]`
+	script := "#!/bin/sh\ncat <<'EOF'\n" + unsorted + "\nEOF\n"
+	if err := os.WriteFile(filepath.Join(dir, "ruff"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	state := NewState()
+	state.Linters = map[string]bool{"mypy": false}
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\nimport sys\nimport os\n")
+	if err := state.LintDocument("file:///nb.py", log.New(os.Stderr, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := state.LinterResults["file:///nb.py"]; len(messages) != 1 || messages[0].code != organizeImportsRule {
+		t.Fatalf("Expected the configured I001 diagnostic to be reported, Got: %+v", messages)
+	}
+	if fixes := state.importFixes["file:///nb.py"]; len(fixes) != 1 || fixes[0].fix == nil {
+		t.Fatalf("Expected the import fix kept for organize imports, Got: %+v", fixes)
+	}
+}
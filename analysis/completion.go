@@ -0,0 +1,246 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	sqlTableReference = regexp.MustCompile("(?i)\\b(?:from|join|into|table|view|update)\\s+(?:if\\s+(?:not\\s+)?exists\\s+)?([A-Za-z_][\\w.]*|`[^`]+`)")
+	tempViewCall      = regexp.MustCompile(`\.create(?:OrReplace)?(?:Global)?TempView\(\s*["']([^"']+)["']`)
+)
+
+// sqlTableKeywords are followed by a table name.
+var sqlTableKeywords = map[string]bool{
+	"from":   true,
+	"join":   true,
+	"into":   true,
+	"table":  true,
+	"update": true,
+}
+
+// sqlClauseKeywords start a clause that decides what can follow a comma.
+var sqlClauseKeywords = map[string]bool{
+	"select": true,
+	"from":   true,
+	"join":   true,
+	"where":  true,
+	"group":  true,
+	"order":  true,
+	"having": true,
+	"on":     true,
+	"set":    true,
+	"values": true,
+}
+
+func (s *State) Completion(id int, uri string, position lsp.Position, logger *log.Logger) *lsp.CompletionResponse {
+
+	doc := s.Documents[uri]
+	items := []lsp.CompletionItem{}
+
+	if sqlText, ok := sqlTextBeforePosition(doc, position); ok {
+		statement := sqlStatementAt(sqlText, sqlTextAfterPosition(doc, position))
+		items = s.sqlCompletionItems(doc, sqlText, statement)
+		logger.Printf("Offering %d SQL completions", len(items))
+	} else if isNotebook(doc) {
+		items = pythonCompletionItems(doc, position)
+	}
+
+	response := lsp.CompletionResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: items,
+	}
+
+	return &response
+}
+
+// sqlCompletionItems completes the word before the cursor. Tables come from
+// the tables created across the workspace, the catalog and the names used in
+// the document. With a catalog, the columns of the statement's tables are
+// offered alongside functions and keywords.
+func (s *State) sqlCompletionItems(doc, sqlText, statement string) []lsp.CompletionItem {
+	word := currentSqlWord(sqlText)
+	before := strings.TrimRight(sqlText[:len(sqlText)-len(word)], " \t\r\n")
+	cat := s.currentCatalog()
+
+	context := sqlCompletionContext(before)
+	if context == "table" {
+		items := s.workspaceTableCompletionItems(word)
+		items = append(items, cat.tableCompletionItems(word)...)
+		items = append(items, tableCompletionItems(findDocumentTables(doc), word)...)
+		return sortedCompletionItems(items)
+	}
+
+	columns, qualified := cat.columnCompletionItems(statement, word)
+	if qualified {
+		return columns
+	}
+	if context == "select" {
+		return append(columns, functionCompletionItems()...)
+	}
+
+	return append(append(columns, keywordCompletionItems()...), functionCompletionItems()...)
+}
+
+// currentSqlWord returns the partially typed identifier at the end of the text.
+func currentSqlWord(text string) string {
+	start := len(text)
+	for start > 0 && (isWordChar(rune(text[start-1])) || text[start-1] == '.' || text[start-1] == '`') {
+		start--
+	}
+	return text[start:]
+}
+
+// sqlCompletionContext decides whether the cursor expects a table, a select
+// expression or anything at all, based on the text before the current word.
+func sqlCompletionContext(before string) string {
+	previous := strings.ToLower(currentSqlWord(before))
+	if previous == "" && strings.HasSuffix(before, ",") {
+		previous = lastClauseKeyword(before)
+	}
+
+	switch {
+	case sqlTableKeywords[previous]:
+		return "table"
+	case previous == "select" || previous == "distinct":
+		return "select"
+	}
+	return ""
+}
+
+func lastClauseKeyword(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordChar(r)
+	})
+
+	for i := len(words) - 1; i >= 0; i-- {
+		if sqlClauseKeywords[words[i]] {
+			return words[i]
+		}
+	}
+	return ""
+}
+
+// findDocumentTables lists the tables and views referenced or created in the
+// SQL of a document.
+func findDocumentTables(doc string) []string {
+	found := map[string]bool{}
+
+	for _, sql := range sqlSources(doc) {
+		for _, match := range sqlTableReference.FindAllStringSubmatch(sql, -1) {
+			name := strings.TrimRight(strings.Trim(match[1], "`"), ".")
+			if !isSqlToken(name) {
+				found[name] = true
+			}
+		}
+	}
+
+	for _, match := range tempViewCall.FindAllStringSubmatch(doc, -1) {
+		found[match[1]] = true
+	}
+
+	var tables []string
+	for name := range found {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	return tables
+}
+
+func tableCompletionItems(tables []string, word string) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+
+	qualifier := ""
+	if idx := strings.LastIndex(word, "."); idx >= 0 {
+		qualifier = strings.ToLower(strings.Trim(word[:idx+1], "`"))
+	}
+
+	for _, table := range tables {
+		if len(table) <= len(qualifier) || !strings.HasPrefix(strings.ToLower(table), qualifier) {
+			continue
+		}
+		items = append(items, lsp.CompletionItem{
+			Label:  table[len(qualifier):],
+			Kind:   lsp.CompletionItemKindStruct,
+			Detail: "table",
+		})
+	}
+
+	return items
+}
+
+func keywordCompletionItems() []lsp.CompletionItem {
+	var items []lsp.CompletionItem
+	seen := map[string]bool{}
+
+	for _, keyword := range GetSqlTokens() {
+		if strings.Contains(keyword, "(") || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		items = append(items, lsp.CompletionItem{
+			Label: strings.ToUpper(keyword),
+			Kind:  lsp.CompletionItemKindKeyword,
+		})
+	}
+
+	return items
+}
+
+func functionCompletionItems() []lsp.CompletionItem {
+	var items []lsp.CompletionItem
+
+	for _, function := range GetSqlFunctions() {
+		if !isWordChar(rune(function[0])) {
+			continue
+		}
+		items = append(items, lsp.CompletionItem{
+			Label:            function,
+			Kind:             lsp.CompletionItemKindFunction,
+			Detail:           "function",
+			InsertText:       sqlFunctionSnippet(function),
+			InsertTextFormat: lsp.InsertTextFormatSnippet,
+		})
+	}
+
+	return items
+}
+
+// sqlFunctionSnippet calls a function with a placeholder for each required
+// parameter of its first overload. Functions with special syntax, such as
+// cast, get a single placeholder.
+func sqlFunctionSnippet(name string) string {
+	function, found := sqlFunctionsByName[strings.ToLower(name)]
+	if !found || len(function.Signatures) == 0 || function.Signatures[0].Syntax != "" {
+		return name + "(${1})"
+	}
+
+	var parameters []string
+	for _, p := range function.Signatures[0].Parameters {
+		if p.Optional {
+			break
+		}
+		parameters = append(parameters, p.Name)
+	}
+	return snippetCall(name, parameters)
+}
+
+var snippetEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
+
+// snippetCall builds a snippet of a call with a placeholder named after each
+// parameter.
+func snippetCall(name string, parameters []string) string {
+	placeholders := make([]string, len(parameters))
+	for i, parameter := range parameters {
+		placeholders[i] = fmt.Sprintf("${%d:%s}", i+1, snippetEscaper.Replace(parameter))
+	}
+	return name + "(" + strings.Join(placeholders, ", ") + ")"
+}
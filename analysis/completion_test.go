@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+const completionNotebook = `# Databricks notebook source
+df.createOrReplaceTempView("recent_orders")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT * FROM sales.orders o JOIN customers c ON o.id = c.id
+# MAGIC SELECT date FROM `
+
+func TestCompletionAfterFromOffersTables(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", completionNotebook)
+
+	response := state.Completion(1, "file:///nb.py", lsp.Position{Line: 6, Character: 25}, log.New(os.Stderr, "", 0))
+
+	var labels []string
+	for _, item := range response.Result {
+		labels = append(labels, item.Label)
+	}
+
+	expected := []string{"customers", "recent_orders", "sales.orders"}
+	if len(labels) != len(expected) {
+		t.Fatalf("Expected: %v, Got: %v", expected, labels)
+	}
+	for i := range expected {
+		if labels[i] != expected[i] {
+			t.Fatalf("Expected: %v, Got: %v", expected, labels)
+		}
+	}
+}
+
+func TestCompletionAfterSelectOffersFunctions(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", completionNotebook)
+
+	response := state.Completion(1, "file:///nb.py", lsp.Position{Line: 6, Character: 15}, log.New(os.Stderr, "", 0))
+
+	if len(response.Result) == 0 {
+		t.Fatal("Expected function completions")
+	}
+	for _, item := range response.Result {
+		if item.Kind != lsp.CompletionItemKindFunction {
+			t.Fatalf("Expected only functions, Got: %+v", item)
+		}
+	}
+
+	snippets := map[string]string{
+		"date_add":     "date_add(${1:startDate}, ${2:numDays})",
+		"substr":       "substr(${1:expr}, ${2:pos})",
+		"current_date": "current_date()",
+		"cast":         "cast(${1})",
+	}
+	for name, expected := range snippets {
+		if snippet := sqlFunctionSnippet(name); snippet != expected {
+			t.Errorf("Expected %s, Got: %s", expected, snippet)
+		}
+	}
+}
+
+func TestCompletionInSparkSqlString(t *testing.T) {
+	doc := "df = spark.sql(\"\"\"\n    SELECT * FROM sales.orders\n    JOIN sales."
+
+	if _, ok := sqlTextBeforePosition(doc, lsp.Position{Line: 0, Character: 5}); ok {
+		t.Fatal("Expected no SQL before spark.sql")
+	}
+
+	sqlText, ok := sqlTextBeforePosition(doc, lsp.Position{Line: 2, Character: 15})
+	if !ok {
+		t.Fatal("Expected SQL inside spark.sql string")
+	}
+
+	state := NewState()
+	items := state.sqlCompletionItems(doc, sqlText, sqlText)
+	if len(items) != 1 || items[0].Label != "orders" {
+		t.Fatalf("Expected: [orders], Got: %+v", items)
+	}
+}
+
+func TestCompletionNotebookGlobals(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\ndf = tab\ndf.")
+	logger := log.New(os.Stderr, "", 0)
+
+	items := state.Completion(1, "file:///nb.py", lsp.Position{Line: 1, Character: 8}, logger).Result
+	var table lsp.CompletionItem
+	for _, item := range items {
+		if item.Label == "table" {
+			table = item
+		}
+	}
+	if table.Detail != "table(tableName: str) -> DataFrame" || table.Kind != lsp.CompletionItemKindFunction {
+		t.Fatalf("Expected table global, Got: %+v", items)
+	}
+
+	if items := state.Completion(1, "file:///nb.py", lsp.Position{Line: 2, Character: 3}, logger).Result; len(items) != 0 {
+		t.Fatalf("Expected no globals after a dot, Got: %+v", items)
+	}
+}
@@ -0,0 +1,35 @@
+# Databricks notebook globals. These names are defined in every notebook and
+# are declared here so that ruff and mypy know them. Everything else is
+# prefixed with an underscore to stay out of the way of the notebook's own
+# imports.
+import typing as _typing
+
+from pyspark import SparkContext as _SparkContext
+from pyspark.sql import DataFrame as _DataFrame
+from pyspark.sql import SparkSession as _SparkSession
+from pyspark.sql import SQLContext as _SQLContext
+
+
+# {dbutils}
+# The _DBUtils protocols are generated from data/dbutils.json in place of the
+# line above.
+
+
+spark = _typing.cast(_SparkSession, None)
+sc = _typing.cast(_SparkContext, None)
+sqlContext = _typing.cast(_SQLContext, None)
+dbutils = _typing.cast(_DBUtils, None)
+
+
+def display(*args: _typing.Any, **kwargs: _typing.Any) -> None: ...
+
+
+def displayHTML(html: str) -> None: ...
+
+
+def table(tableName: str) -> _DataFrame:
+    return spark.table(tableName)
+
+
+def getArgument(name: str, defaultValue: _typing.Optional[str] = None) -> str:
+    return dbutils.widgets.getArgument(name, defaultValue)
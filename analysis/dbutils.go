@@ -0,0 +1,466 @@
+package analysis
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"myfirstlsp/lsp"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+//go:embed data/dbutils.json
+var dbutilsData []byte
+
+// dbutilsStubMarker is the line of the notebook globals stub that is replaced
+// by the protocols generated from the dbutils model.
+const dbutilsStubMarker = "# {dbutils}"
+
+// dbutilsProtocolPrefix names the generated protocols. Mypy messages about
+// them are left to the dbutils checks, which know the real names.
+const dbutilsProtocolPrefix = "_DBUtils"
+
+// dbutilsModule is partial when the model does not describe all of its
+// members, such as notebook.entry_point. Members missing from it are not
+// reported.
+type dbutilsModule struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Partial     bool            `json:"partial"`
+	Methods     []dbutilsMethod `json:"methods"`
+	Modules     []dbutilsModule `json:"modules"`
+}
+
+type dbutilsMethod struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Parameters  []dbutilsParameter `json:"parameters"`
+	Returns     string             `json:"returns"`
+}
+
+// dbutilsParameter is optional when it has a default.
+type dbutilsParameter struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+}
+
+var (
+	dbutilsCall         = regexp.MustCompile(`\bdbutils((?:\.\w+)+)\s*\(`)
+	dbutilsMemberAccess = regexp.MustCompile(`\bdbutils((?:\.\w+)*)\.(\w*)$`)
+	stubTypeName        = regexp.MustCompile(`[A-Za-z_]\w*`)
+)
+
+// stubBuiltinTypes are used as they are in the generated protocols. Other
+// types from the model, such as FileInfo, are typed as Any.
+var stubBuiltinTypes = map[string]bool{
+	"str":   true,
+	"int":   true,
+	"bool":  true,
+	"bytes": true,
+	"float": true,
+	"None":  true,
+}
+
+// stubGenericTypes come from typing, as a method such as secrets.list would
+// otherwise hide the builtin in the annotations of its protocol.
+var stubGenericTypes = map[string]string{
+	"list": "_typing.List",
+	"dict": "_typing.Dict",
+}
+
+var stubTypingNames = map[string]bool{
+	"Any":      true,
+	"Optional": true,
+	"NoReturn": true,
+}
+
+var dbutilsAPI = loadDbutilsModel(dbutilsData)
+
+func loadDbutilsModel(data []byte) dbutilsModule {
+	var model dbutilsModule
+	if err := json.Unmarshal(data, &model); err != nil {
+		panic(fmt.Sprintf("invalid embedded dbutils data: %s", err))
+	}
+	return model
+}
+
+func (m *dbutilsModule) module(name string) *dbutilsModule {
+	for i := range m.Modules {
+		if m.Modules[i].Name == name {
+			return &m.Modules[i]
+		}
+	}
+	return nil
+}
+
+func (m *dbutilsModule) method(name string) *dbutilsMethod {
+	for i := range m.Methods {
+		if m.Methods[i].Name == name {
+			return &m.Methods[i]
+		}
+	}
+	return nil
+}
+
+// lookup follows a path such as ["fs", "ls"] from the module. It returns the
+// last module reached, the method the path ends on, if any, and how many parts
+// of the path were found.
+func (m *dbutilsModule) lookup(path []string) (*dbutilsModule, *dbutilsMethod, int) {
+	current := m
+
+	for i, part := range path {
+		if sub := current.module(part); sub != nil {
+			current = sub
+			continue
+		}
+		if method := current.method(part); method != nil && i == len(path)-1 {
+			return current, method, len(path)
+		}
+		return current, nil, i
+	}
+
+	return current, nil, len(path)
+}
+
+func (p dbutilsParameter) label() string {
+	label := p.Name + ": " + p.Type
+	if p.Default != "" {
+		label += " = " + p.Default
+	}
+	return label
+}
+
+func (method dbutilsMethod) label(path string) string {
+	var params []string
+	for _, p := range method.Parameters {
+		params = append(params, p.label())
+	}
+	return fmt.Sprintf("%s.%s(%s) -> %s", path, method.Name, strings.Join(params, ", "), method.Returns)
+}
+
+func (method dbutilsMethod) documentation(path string) string {
+	return fmt.Sprintf("```python\n%s\n```\n\n%s", method.label(path), method.Description)
+}
+
+func (m dbutilsModule) documentation(path string) string {
+	return fmt.Sprintf("```python\n%s\n```\n\n%s", path, m.Description)
+}
+
+func (method dbutilsMethod) requiredParameters() int {
+	required := 0
+	for _, p := range method.Parameters {
+		if p.Default == "" {
+			required++
+		}
+	}
+	return required
+}
+
+// protocols writes the module, and the modules below it, as typing.Protocol
+// classes for the notebook globals stub.
+func (m dbutilsModule) protocols(className string) []string {
+	var lines []string
+
+	for _, sub := range m.Modules {
+		lines = append(lines, sub.protocols(className+capitalise(sub.Name))...)
+	}
+
+	lines = append(lines, fmt.Sprintf("class %s(_typing.Protocol):", className))
+	for _, sub := range m.Modules {
+		lines = append(lines, fmt.Sprintf("    %s: %s", sub.Name, className+capitalise(sub.Name)))
+	}
+	for _, method := range m.Methods {
+		lines = append(lines, "    "+method.stub())
+	}
+	if m.Partial {
+		lines = append(lines, "    def __getattr__(self, name: str) -> _typing.Any: ...")
+	} else if len(m.Modules) == 0 && len(m.Methods) == 0 {
+		lines = append(lines, "    pass")
+	}
+
+	return append(lines, "", "")
+}
+
+func (method dbutilsMethod) stub() string {
+	params := []string{"self"}
+	for _, p := range method.Parameters {
+		param := p.Name + ": " + stubType(p.Type)
+		if p.Default != "" {
+			param += " = " + p.Default
+		}
+		params = append(params, param)
+	}
+	return fmt.Sprintf("def %s(%s) -> %s: ...", method.Name, strings.Join(params, ", "), stubType(method.Returns))
+}
+
+func stubType(modelType string) string {
+	return stubTypeName.ReplaceAllStringFunc(modelType, func(name string) string {
+		switch {
+		case stubBuiltinTypes[name]:
+			return name
+		case stubTypingNames[name]:
+			return "_typing." + name
+		case stubGenericTypes[name] != "":
+			return stubGenericTypes[name]
+		}
+		return "_typing.Any"
+	})
+}
+
+func capitalise(name string) string {
+	if name == "" {
+		return name
+	}
+	return string(unicode.ToUpper(rune(name[0]))) + name[1:]
+}
+
+// dbutilsCompletionItems offers the modules and methods after "dbutils." or
+// one of its modules. It reports false when the text does not end in a
+// dbutils member access.
+func dbutilsCompletionItems(textBefore string) ([]lsp.CompletionItem, bool) {
+	match := dbutilsMemberAccess.FindStringSubmatch(textBefore)
+	if match == nil {
+		return nil, false
+	}
+
+	items := []lsp.CompletionItem{}
+
+	path := dottedPath(match[1])
+	module, method, matched := dbutilsAPI.lookup(path)
+	if method != nil || matched < len(path) {
+		return items, true
+	}
+
+	prefix := "dbutils" + match[1]
+	for _, sub := range module.Modules {
+		items = append(items, lsp.CompletionItem{
+			Label:         sub.Name,
+			Kind:          lsp.CompletionItemKindModule,
+			Detail:        prefix + "." + sub.Name,
+			Documentation: sub.Description,
+		})
+	}
+	for _, m := range module.Methods {
+		items = append(items, lsp.CompletionItem{
+			Label:            m.Name,
+			Kind:             lsp.CompletionItemKindMethod,
+			Detail:           m.label(prefix),
+			Documentation:    m.Description,
+			InsertText:       m.snippet(),
+			InsertTextFormat: lsp.InsertTextFormatSnippet,
+		})
+	}
+
+	return items, true
+}
+
+// snippet calls the method with a placeholder for each parameter that has
+// no default.
+func (m dbutilsMethod) snippet() string {
+	var parameters []string
+	for _, p := range m.Parameters {
+		if p.Default == "" {
+			parameters = append(parameters, p.Name)
+		}
+	}
+	return snippetCall(m.Name, parameters)
+}
+
+// dottedPath splits ".fs.ls" into its parts.
+func dottedPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(path, "."), ".")
+}
+
+// dbutilsDocumentation documents the dbutils module or method under the cursor.
+func dbutilsDocumentation(line string, character int) (string, bool) {
+	start, end := wordBounds(line, character)
+	if start == end {
+		return "", false
+	}
+
+	name := lastDottedName(line[:end])
+	parts := strings.Split(name, ".")
+	if parts[0] != "dbutils" {
+		return "", false
+	}
+
+	path := parts[1:]
+	module, method, matched := dbutilsAPI.lookup(path)
+	if matched < len(path) {
+		return "", false
+	}
+
+	parent := strings.Join(parts[:len(parts)-1], ".")
+	if method != nil {
+		return method.documentation(parent), true
+	}
+	return module.documentation(name), true
+}
+
+// dbutilsSignatureHelp returns signature help for an open dbutils call.
+func dbutilsSignatureHelp(call openCall) (*lsp.SignatureHelp, bool) {
+	parts := strings.Split(call.name, ".")
+	if parts[0] != "dbutils" {
+		return nil, false
+	}
+
+	_, method, _ := dbutilsAPI.lookup(parts[1:])
+	if method == nil {
+		return nil, false
+	}
+
+	information := lsp.SignatureInformation{
+		Label: method.label(strings.Join(parts[:len(parts)-1], ".")),
+		Documentation: &lsp.MarkupContent{
+			Kind:  lsp.MarkupKindMarkdown,
+			Value: method.Description,
+		},
+		Parameters: []lsp.ParameterInformation{},
+	}
+	for _, p := range method.Parameters {
+		information.Parameters = append(information.Parameters, lsp.ParameterInformation{Label: p.label()})
+	}
+
+	return &lsp.SignatureHelp{
+		Signatures:      []lsp.SignatureInformation{information},
+		ActiveParameter: call.commas,
+	}, true
+}
+
+// dbutilsMessages checks the dbutils calls in the Python cells of a notebook
+// against the dbutils model, reporting unknown modules and methods and calls
+// with the wrong number of arguments. Members of partial modules that the
+// model does not know are left alone.
+func dbutilsMessages(doc string) []errorMessage {
+	var messages []errorMessage
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "python" {
+			continue
+		}
+		text := strings.Join(c.lines, "\n")
+
+		for _, match := range dbutilsCall.FindAllStringSubmatchIndex(text, -1) {
+			if inPythonComment(text, match[0]) {
+				continue
+			}
+
+			path := dottedPath(text[match[2]:match[3]])
+			module, method, matched := dbutilsAPI.lookup(path)
+
+			if matched < len(path) && module.Partial {
+				continue
+			}
+			if matched < len(path) {
+				partStart := match[2]
+				for _, part := range path[:matched] {
+					partStart += len(part) + 1
+				}
+				partStart++
+				messages = append(messages, c.dbutilsMessage(partStart, partStart+len(path[matched]), "unknown-attribute",
+					fmt.Sprintf("dbutils%s has no module or method `%s`", moduleSuffix(path[:matched]), path[matched])))
+				continue
+			}
+			if method == nil {
+				continue
+			}
+
+			given, ok := countArguments(text[match[1]:])
+			if !ok {
+				continue
+			}
+			required, total := method.requiredParameters(), len(method.Parameters)
+			if given >= required && given <= total {
+				continue
+			}
+
+			expected := fmt.Sprintf("%d", required)
+			if required != total {
+				expected = fmt.Sprintf("%d to %d", required, total)
+			}
+			messages = append(messages, c.dbutilsMessage(match[0], match[3], "argument-count",
+				fmt.Sprintf("dbutils%s takes %s arguments but %d were given", moduleSuffix(path), expected, given)))
+		}
+	}
+
+	return messages
+}
+
+func moduleSuffix(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return "." + strings.Join(path, ".")
+}
+
+func (c cell) dbutilsMessage(start, end int, code, desc string) errorMessage {
+	startPosition := c.sourcePosition(c.lines, start)
+	endPosition := c.sourcePosition(c.lines, end)
+
+	return errorMessage{
+		line:     startPosition.Line + 1,
+		char:     startPosition.Character + 1,
+		endLine:  endPosition.Line + 1,
+		endChar:  endPosition.Character + 1,
+		code:     code,
+		desc:     desc,
+		source:   "dbutils",
+		severity: 1,
+	}
+}
+
+// countArguments counts the arguments of a call, given the text after its
+// opening bracket. It reports false when the call is not closed or unpacks
+// arguments with * or **, as the count is then unknown.
+func countArguments(text string) (int, bool) {
+	depth := 0
+	count := 0
+	argumentStarted := false
+
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+
+		switch {
+		case char == '\'' || char == '"':
+			end := strings.IndexByte(text[i+1:], char)
+			if end < 0 {
+				return 0, false
+			}
+			i += end + 1
+		case char == '#':
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				return 0, false
+			}
+			i += end
+			continue
+		case char == '(' || char == '[' || char == '{':
+			depth++
+		case char == ')' || char == ']' || char == '}':
+			if depth == 0 {
+				if argumentStarted {
+					count++
+				}
+				return count, true
+			}
+			depth--
+		case char == ',' && depth == 0:
+			count++
+			argumentStarted = false
+			continue
+		case char == '*' && depth == 0 && !argumentStarted:
+			return 0, false
+		case unicode.IsSpace(rune(char)):
+			continue
+		}
+
+		argumentStarted = true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"strings"
+	"testing"
+)
+
+const dbutilsNotebook = `# Databricks notebook source
+files = dbutils.fs.ls("/mnt/raw")
+dbutils.fs.lss("/mnt/raw")
+dbutils.jobs.taskValues.set("rows")
+dbutils.widgets.text("env", "dev", "Environment")
+dbutils.fs.`
+
+func TestDbutilsCompletionHoverAndSignatureHelp(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", dbutilsNotebook)
+	logger := log.New(os.Stderr, "", 0)
+
+	items := state.Completion(1, "file:///nb.py", lsp.Position{Line: 5, Character: 11}, logger).Result
+	if len(items) != len(dbutilsAPI.module("fs").Methods) || items[0].Label != "cp" {
+		t.Fatalf("Expected dbutils.fs methods, Got: %+v", items)
+	}
+	if items[0].InsertText != "cp(${1:from_}, ${2:to})" {
+		t.Fatalf("Expected placeholders for the required cp parameters, Got: %s", items[0].InsertText)
+	}
+
+	hover := state.Hover(1, "file:///nb.py", lsp.Position{Line: 1, Character: 20}, logger)
+	if hover.Result == nil || !strings.HasPrefix(hover.Result.Contents.Value, "```python\ndbutils.fs.ls(dir: str) -> list[FileInfo]") {
+		t.Fatalf("Expected ls documentation, Got: %+v", hover.Result)
+	}
+
+	help := state.SignatureHelp(1, "file:///nb.py", lsp.Position{Line: 4, Character: 28}, logger).Result
+	if help == nil || help.ActiveParameter != 1 || !strings.HasPrefix(help.Signatures[0].Label, "dbutils.widgets.text(name: str") {
+		t.Fatalf("Expected widgets.text help on defaultValue, Got: %+v", help)
+	}
+}
+
+func TestDbutilsMessages(t *testing.T) {
+	messages := dbutilsMessages(dbutilsNotebook)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, Got: %+v", messages)
+	}
+
+	unknown := messages[0]
+	if unknown.code != "unknown-attribute" || unknown.line != 3 || unknown.char != 12 || unknown.endChar != 15 {
+		t.Fatalf("Expected lss to be unknown, Got: %+v", unknown)
+	}
+
+	count := messages[1]
+	if count.code != "argument-count" || count.line != 4 || count.desc != "dbutils.jobs.taskValues.set takes 2 arguments but 1 were given" {
+		t.Fatalf("Expected argument count message, Got: %+v", count)
+	}
+}
+
+func TestDbutilsMessagesKnowHelpAndPartialModules(t *testing.T) {
+	doc := `# Databricks notebook source
+dbutils.help()
+dbutils.fs.help("cp")
+context = dbutils.notebook.entry_point.getDbutils().notebook().getContext()
+dbutils.library.installPyPI("pandas")
+dbutils.fs.helps()`
+
+	messages := dbutilsMessages(doc)
+	if len(messages) != 1 || messages[0].line != 6 || messages[0].desc != "dbutils.fs has no module or method `helps`" {
+		t.Fatalf("Expected only the unknown fs member, Got: %+v", messages)
+	}
+	if !strings.Contains(strings.Join(dbutilsAPI.protocols(dbutilsProtocolPrefix), "\n"), "class _DBUtilsNotebookEntry_point(_typing.Protocol):\n    def __getattr__") {
+		t.Fatal("Expected the entry_point protocol to allow any member")
+	}
+}
@@ -0,0 +1,372 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"myfirstlsp/lsp"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const mypyErrorCodeDocs = "https://mypy.readthedocs.io/en/stable/error_code_list.html#code-"
+
+const mypyOptionalErrorCodeDocs = "https://mypy.readthedocs.io/en/stable/error_code_list2.html#code-"
+
+// mypyOptionalErrorCodes are documented on the page for optional checks.
+var mypyOptionalErrorCodes = map[string]bool{
+	"type-arg":            true,
+	"no-untyped-def":      true,
+	"redundant-cast":      true,
+	"redundant-self":      true,
+	"comparison-overlap":  true,
+	"no-untyped-call":     true,
+	"no-any-return":       true,
+	"no-any-unimported":   true,
+	"unreachable":         true,
+	"redundant-expr":      true,
+	"possibly-undefined":  true,
+	"truthy-bool":         true,
+	"truthy-iterable":     true,
+	"ignore-without-code": true,
+	"unused-awaitable":    true,
+	"unused-ignore":       true,
+	"explicit-override":   true,
+	"mutable-override":    true,
+}
+
+var severityNames = map[int]string{
+	1: "Error",
+	2: "Warning",
+	3: "Information",
+	4: "Hint",
+}
+
+type ruffLocation struct {
+	Row    int `json:"row"`
+	Column int `json:"column"`
+}
+
+type ruffResult struct {
+	Code        *string      `json:"code"`
+	Message     string       `json:"message"`
+	Location    ruffLocation `json:"location"`
+	EndLocation ruffLocation `json:"end_location"`
+	URL         *string      `json:"url"`
+	Fix         *ruffFix     `json:"fix"`
+}
+
+type ruffFix struct {
+	Applicability string     `json:"applicability"`
+	Message       *string    `json:"message"`
+	Edits         []ruffEdit `json:"edits"`
+}
+
+type ruffEdit struct {
+	Content     string       `json:"content"`
+	Location    ruffLocation `json:"location"`
+	EndLocation ruffLocation `json:"end_location"`
+}
+
+// lintFix is a fix offered by a linter, with 1-based positions like the
+// message it belongs to.
+type lintFix struct {
+	title         string
+	applicability string
+	edits         []lintEdit
+}
+
+type lintEdit struct {
+	line    int
+	char    int
+	endLine int
+	endChar int
+	content string
+}
+
+// parseRuffResults reads the output of `ruff check --output-format json`.
+func parseRuffResults(output string) ([]errorMessage, error) {
+	var results []ruffResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		return nil, err
+	}
+
+	var messages []errorMessage
+	for _, r := range results {
+		code := "syntax-error"
+		if r.Code != nil {
+			code = *r.Code
+		}
+		url := ""
+		if r.URL != nil {
+			url = *r.URL
+		}
+
+		messages = append(messages, errorMessage{
+			line:     r.Location.Row,
+			char:     r.Location.Column,
+			endLine:  r.EndLocation.Row,
+			endChar:  r.EndLocation.Column,
+			code:     code,
+			desc:     r.Message,
+			source:   "Ruff",
+			severity: lintSeverity(code),
+			url:      url,
+			fix:      r.Fix.lintFix(code),
+		})
+	}
+
+	return messages, nil
+}
+
+func (fix *ruffFix) lintFix(code string) *lintFix {
+	if fix == nil || len(fix.Edits) == 0 {
+		return nil
+	}
+
+	title := "Fix " + code
+	if fix.Message != nil && *fix.Message != "" {
+		title = *fix.Message
+	}
+
+	converted := lintFix{title: title, applicability: fix.Applicability}
+	for _, edit := range fix.Edits {
+		converted.edits = append(converted.edits, lintEdit{
+			line:    edit.Location.Row,
+			char:    edit.Location.Column,
+			endLine: edit.EndLocation.Row,
+			endChar: edit.EndLocation.Column,
+			content: edit.Content,
+		})
+	}
+
+	return &converted
+}
+
+// parseTypeResults reads mypy output of the form
+// "file.py:line:column: severity: message  [code]".
+func parseTypeResults(output string) []errorMessage {
+	var messages []errorMessage
+
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, ".py:") {
+			continue
+		}
+		errorStr := strings.Split(line, ".py:")
+		fields := strings.SplitN(errorStr[len(errorStr)-1], ":", 4)
+		if len(fields) < 4 {
+			continue
+		}
+
+		lineNo, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		char, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+
+		level := strings.TrimSpace(fields[2])
+		desc := strings.TrimSpace(fields[3])
+		code := level
+		url := ""
+
+		if strings.HasSuffix(desc, "]") {
+			if start := strings.LastIndex(desc, "["); start >= 0 {
+				code = desc[start+1 : len(desc)-1]
+				desc = strings.TrimSpace(desc[:start])
+				url = mypyErrorCodeDocs + code
+				if mypyOptionalErrorCodes[code] {
+					url = mypyOptionalErrorCodeDocs + code
+				}
+			}
+		}
+
+		messages = append(messages, errorMessage{
+			line:     lineNo,
+			char:     char,
+			code:     code,
+			desc:     desc,
+			source:   "mypy",
+			severity: lintSeverity(level),
+			url:      url,
+		})
+	}
+
+	return messages
+}
+
+func lintSeverity(code string) int {
+	severity := 3
+	if strings.Contains(code, "E") || strings.Contains(code, "warning") {
+		severity = 2
+	} else if strings.Contains(code, "F") || strings.Contains(code, "error") {
+		severity = 1
+	}
+	return severity
+}
+
+// redefinitionCodes are ruff's and mypy's codes for a name defined again.
+var redefinitionCodes = map[string]bool{"F811": true, "no-redef": true}
+
+// redefinedFrom reads the line of the first definition from a redefinition
+// message, such as "Redefinition of unused `display` from line 24".
+var redefinedFrom = regexp.MustCompile(`(?:from|on) line (\d+)`)
+
+// mapLintLines moves messages from the lines of the lint file back to the
+// document lines they came from, dropping those raised in inlined notebooks.
+// Redefinitions of names first defined in the notebook globals stub or an
+// inlined notebook are dropped too, as the notebook may rebind them, for
+// example by importing display from databricks.sdk.runtime.
+func mapLintLines(messages []errorMessage, lineMap []int) []errorMessage {
+	if lineMap == nil {
+		return messages
+	}
+
+	var mapped []errorMessage
+	for _, msg := range messages {
+		if msg.line < 1 || msg.line > len(lineMap) || lineMap[msg.line-1] < 0 {
+			continue
+		}
+		if redefinesInlinedLine(msg, lineMap) {
+			continue
+		}
+		line := lineMap[msg.line-1] + 1
+
+		if msg.endLine >= 1 && msg.endLine <= len(lineMap) && lineMap[msg.endLine-1] >= 0 {
+			msg.endLine = lineMap[msg.endLine-1] + 1
+		} else if msg.endLine != 0 {
+			msg.endLine = line
+			msg.endChar = msg.char
+		}
+		msg.line = line
+		msg.fix = msg.fix.mapLines(lineMap)
+
+		mapped = append(mapped, msg)
+	}
+
+	return mapped
+}
+
+// redefinesInlinedLine reports whether a message is about redefining a name
+// first defined on a line of the lint file that is not in the document.
+func redefinesInlinedLine(msg errorMessage, lineMap []int) bool {
+	if !redefinitionCodes[msg.code] {
+		return false
+	}
+	match := redefinedFrom.FindStringSubmatch(msg.desc)
+	if match == nil {
+		return false
+	}
+	line, err := strconv.Atoi(match[1])
+	return err == nil && line >= 1 && line <= len(lineMap) && lineMap[line-1] < 0
+}
+
+// mapLines moves the edits of a fix back to document lines. Fixes that edit
+// inlined lines are dropped. An edit ending at the start of an inlined line
+// ends at the start of the document line that follows instead.
+func (fix *lintFix) mapLines(lineMap []int) *lintFix {
+	if fix == nil {
+		return nil
+	}
+
+	mapped := lintFix{title: fix.title, applicability: fix.applicability}
+	for _, edit := range fix.edits {
+		line, ok := mapLintLine(edit.line, edit.char, lineMap)
+		if !ok {
+			return nil
+		}
+		endLine, ok := mapLintLine(edit.endLine, edit.endChar, lineMap)
+		if !ok {
+			return nil
+		}
+
+		edit.line, edit.endLine = line, endLine
+		mapped.edits = append(mapped.edits, edit)
+	}
+
+	return &mapped
+}
+
+func mapLintLine(line, char int, lineMap []int) (int, bool) {
+	switch {
+	case line >= 1 && line <= len(lineMap) && lineMap[line-1] >= 0:
+		return lineMap[line-1] + 1, true
+	case char == 1 && line >= 2 && line <= len(lineMap)+1 && lineMap[line-2] >= 0:
+		return lineMap[line-2] + 2, true
+	}
+	return 0, false
+}
+
+// fillEndPosition gives messages without an end position one that covers the
+// word at their start, or the rest of the line.
+func fillEndPosition(messages []errorMessage, doc string) {
+	lines := splitCellIntoLines(doc)
+
+	for i, msg := range messages {
+		if msg.endLine != 0 {
+			continue
+		}
+		messages[i].endLine = msg.line
+		messages[i].endChar = msg.char
+
+		if msg.line < 1 || msg.line > len(lines) {
+			continue
+		}
+		line := lines[msg.line-1]
+		_, end := wordBounds(line, min(max(msg.char-1, 0), len(line)))
+		if end <= msg.char-1 {
+			end = len(line)
+		}
+		messages[i].endChar = end + 1
+	}
+}
+
+func (msg errorMessage) lspRange() lsp.Range {
+	return lsp.Range{
+		StartPosition: lsp.Position{
+			Line:      msg.line - 1,
+			Character: max(msg.char-1, 0)},
+		EndPosition: lsp.Position{
+			Line:      msg.endLine - 1,
+			Character: max(msg.endChar-1, 0)},
+	}
+}
+
+func (msg errorMessage) diagnostic() lsp.Diagnostic {
+	diagnostic := lsp.Diagnostic{
+		Range:    msg.lspRange(),
+		Severity: msg.severity,
+		Code:     msg.code,
+		Source:   msg.source,
+		Message:  msg.desc,
+	}
+	if msg.url != "" {
+		diagnostic.CodeDescription = &lsp.CodeDescription{Href: msg.url}
+	}
+	return diagnostic
+}
+
+func (msg errorMessage) contains(position lsp.Position) bool {
+	r := msg.lspRange()
+
+	if position.Line < r.StartPosition.Line || position.Line > r.EndPosition.Line {
+		return false
+	}
+	if position.Line == r.StartPosition.Line && position.Character < r.StartPosition.Character {
+		return false
+	}
+	if position.Line == r.EndPosition.Line && position.Character > r.EndPosition.Character {
+		return false
+	}
+	return true
+}
+
+func (msg errorMessage) markdown() string {
+	text := fmt.Sprintf("**%s** `%s` (%s)\n\n%s", severityNames[msg.severity], msg.code, msg.source, msg.desc)
+	if msg.url != "" {
+		text += fmt.Sprintf("\n\n[Documentation for %s](%s)", msg.code, msg.url)
+	}
+	return text
+}
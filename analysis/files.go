@@ -1,6 +1,11 @@
 package analysis
 
-import "strings"
+import (
+	"myfirstlsp/lsp"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
 
 func GetTempFileName(fileName string) string {
 	newFileName := strings.ReplaceAll(fileName, ":", "_")
@@ -13,3 +18,26 @@ func GetTempFileName(fileName string) string {
 func GetTempPath() string {
 	return "./.customLsp/.tempFiles/"
 }
+
+// SetWorkspaceRoot records the folder the client opened, preferring the first
+// workspace folder over the older rootUri.
+func (s *State) SetWorkspaceRoot(rootURI string, folders []lsp.WorkspaceFolder) {
+	if len(folders) > 0 {
+		rootURI = folders[0].URI
+	}
+	if rootURI != "" {
+		s.WorkspaceRoot = uriToPath(rootURI)
+	}
+}
+
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
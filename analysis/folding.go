@@ -0,0 +1,157 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"strings"
+)
+
+func (s *State) FoldingRanges(id int, uri string, logger *log.Logger) *lsp.FoldingRangeResponse {
+
+	ranges := []lsp.FoldingRange{}
+
+	doc := s.Documents[uri]
+	if isNotebook(doc) {
+		for _, c := range splitIntoCells(doc) {
+			ranges = append(ranges, cellFoldingRanges(c)...)
+		}
+	}
+	logger.Printf("Found %d folding ranges", len(ranges))
+
+	response := lsp.FoldingRangeResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: ranges,
+	}
+
+	return &response
+}
+
+// cellFoldingRanges folds the cell itself, starting on its separator line so
+// the separator stays visible, and the blocks inside it.
+func cellFoldingRanges(c cell) []lsp.FoldingRange {
+	var ranges []lsp.FoldingRange
+
+	start := max(c.startLine-1, 0)
+	ranges = appendFoldingRange(ranges, c, start, c.startLine+len(c.lines)-1, lsp.FoldingRangeKindRegion)
+
+	ranges = append(ranges, magicBlockFoldingRanges(c)...)
+
+	switch c.language {
+	case "sql":
+		for _, statement := range sqlStatementLines(c) {
+			ranges = appendFoldingRange(ranges, c, statement[0], statement[1], lsp.FoldingRangeKindRegion)
+		}
+	case "md":
+		for _, symbol := range flattenSymbols(markdownSymbols(c)) {
+			ranges = appendFoldingRange(ranges, c, symbol.Range.StartPosition.Line, symbol.Range.EndPosition.Line, lsp.FoldingRangeKindRegion)
+		}
+	}
+
+	return ranges
+}
+
+// appendFoldingRange adds a range once trailing blank lines are dropped, as
+// long as it still spans more than one line.
+func appendFoldingRange(ranges []lsp.FoldingRange, c cell, first, last int, kind string) []lsp.FoldingRange {
+	for last > first && last >= c.startLine && strings.TrimSpace(c.lines[last-c.startLine]) == "" {
+		last--
+	}
+	if last <= first {
+		return ranges
+	}
+	return append(ranges, lsp.FoldingRange{StartLine: first, EndLine: last, Kind: kind})
+}
+
+// magicBlockFoldingRanges folds each run of consecutive "# MAGIC" lines.
+func magicBlockFoldingRanges(c cell) []lsp.FoldingRange {
+	var ranges []lsp.FoldingRange
+	first := -1
+
+	for i, line := range append(c.lines, "") {
+		if _, _, isMagic := magicContent(line); isMagic {
+			if first < 0 {
+				first = c.startLine + i
+			}
+			continue
+		}
+		if first >= 0 {
+			ranges = appendFoldingRange(ranges, c, first, c.startLine+i-1, lsp.FoldingRangeKindComment)
+			first = -1
+		}
+	}
+
+	return ranges
+}
+
+// sqlStatementLines returns the first and last line of every statement in a
+// SQL cell, splitting on semicolons outside of strings and comments.
+func sqlStatementLines(c cell) [][2]int {
+	var statements [][2]int
+
+	source := c.source()
+	sql := []byte(strings.Join(source, "\n"))
+
+	// Blank out the magic command so it is not read as part of a statement.
+	for i, char := range sql {
+		if char == '%' {
+			for j := i; j < len(sql) && sql[j] != ' ' && sql[j] != '\n'; j++ {
+				sql[j] = ' '
+			}
+			break
+		}
+		if char != ' ' && char != '\t' && char != '\n' {
+			break
+		}
+	}
+
+	start := -1
+	for i := 0; i < len(sql); i++ {
+		char := sql[i]
+
+		switch {
+		case char == '\'' || char == '"' || char == '`':
+			if end := strings.IndexByte(string(sql[i+1:]), char); end >= 0 {
+				if start < 0 {
+					start = i
+				}
+				i += end + 1
+				continue
+			}
+		case char == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			if end := strings.IndexByte(string(sql[i:]), '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+			continue
+		case char == ';':
+			if start >= 0 {
+				statements = append(statements, [2]int{c.sourcePosition(source, start).Line, c.sourcePosition(source, i).Line})
+			}
+			start = -1
+			continue
+		}
+
+		if start < 0 && char != ' ' && char != '\t' && char != '\n' && char != '\r' {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		statements = append(statements, [2]int{c.sourcePosition(source, start).Line, c.startLine + len(c.lines) - 1})
+	}
+
+	return statements
+}
+
+func flattenSymbols(symbols []lsp.DocumentSymbol) []lsp.DocumentSymbol {
+	var flat []lsp.DocumentSymbol
+	for _, symbol := range symbols {
+		flat = append(flat, symbol)
+		flat = append(flat, flattenSymbols(symbol.Children)...)
+	}
+	return flat
+}
@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+func TestFoldingRanges(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", symbolNotebook+`
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT 1;
+# MAGIC SELECT a,
+# MAGIC        b
+# MAGIC FROM t`)
+
+	ranges := state.FoldingRanges(1, "file:///nb.py", log.New(os.Stderr, "", 0)).Result
+
+	expected := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 3, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 5, EndLine: 10, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 8, EndLine: 10, Kind: lsp.FoldingRangeKindComment},
+		{StartLine: 9, EndLine: 10, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 12, EndLine: 16, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 14, EndLine: 16, Kind: lsp.FoldingRangeKindComment},
+		{StartLine: 15, EndLine: 16, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 18, EndLine: 24, Kind: lsp.FoldingRangeKindRegion},
+		{StartLine: 20, EndLine: 24, Kind: lsp.FoldingRangeKindComment},
+		{StartLine: 22, EndLine: 24, Kind: lsp.FoldingRangeKindRegion},
+	}
+
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %d ranges, Got: %+v", len(expected), ranges)
+	}
+	for i := range expected {
+		if ranges[i] != expected[i] {
+			t.Fatalf("Expected %+v at %d, Got: %+v", expected[i], i, ranges[i])
+		}
+	}
+}
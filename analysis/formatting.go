@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"os/exec"
+	"strings"
+)
+
+// formatter formats the source of a single cell.
+type formatter func(source string) (string, error)
+
+// Formatting formats each cell of a document on its own, so that the
+// separators, titles and cells of other languages between them are left
+// exactly as they are. Python cells go through ruff format and %sql cells and
+// spark.sql strings through the SQL formatter. With a range, only the cells it
+// touches are formatted.
+func (s *State) Formatting(id int, uri string, r *lsp.Range, options lsp.FormattingOptions, logger *log.Logger) *lsp.DocumentFormattingResponse {
+
+	edits := []lsp.TextEdit{}
+
+	format, err := ruffFormatter(uriToPath(uri))
+	if err != nil {
+		logger.Printf("Formatting SQL only: %s", err)
+	}
+
+	edits = append(edits, formatCells(s.Documents[uri], r, format, s.SQLFormat, options.TabSize, logger)...)
+	logger.Printf("Formatting made %d edits", len(edits))
+
+	response := lsp.DocumentFormattingResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: edits,
+	}
+
+	return &response
+}
+
+// ruffFormatter runs `ruff format` on a cell, passing the document path so
+// that ruff finds the project's settings.
+func ruffFormatter(path string) (formatter, error) {
+	execPath, err := exec.LookPath("ruff")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(source string) (string, error) {
+		command := exec.Command(execPath, "format", "--stdin-filename", path, "-")
+		command.Stdin = strings.NewReader(source)
+
+		var out, stderr bytes.Buffer
+		command.Stdout = &out
+		command.Stderr = &stderr
+		if err := command.Run(); err != nil {
+			return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return out.String(), nil
+	}, nil
+}
+
+// formatCells returns the edits that format the cells of a document. The
+// Python formatter may be nil, which leaves Python code as it is apart from
+// its spark.sql strings.
+func formatCells(doc string, r *lsp.Range, format formatter, sqlOptions lsp.SQLFormatOptions, tabSize int, logger *log.Logger) []lsp.TextEdit {
+	var edits []lsp.TextEdit
+
+	newline := "\n"
+	if strings.Contains(doc, "\r\n") {
+		newline = "\r\n"
+	}
+
+	for _, c := range splitIntoCells(doc) {
+		start, body := c.formattableLines()
+		if len(body) == 0 {
+			continue
+		}
+		if r != nil && (start+len(body) <= r.StartPosition.Line || start > r.EndPosition.Line) {
+			continue
+		}
+
+		var formatted []string
+		switch c.language {
+		case "sql":
+			lines, ok := formatSqlCell(body, sqlOptions, tabSize)
+			if !ok {
+				logger.Printf("Could not format the SQL cell at line %d", c.startLine+1)
+				continue
+			}
+			formatted = lines
+		default:
+			source := strings.Join(body, "\n") + "\n"
+			if format != nil {
+				var err error
+				if source, err = format(source); err != nil {
+					logger.Printf("Could not format the cell at line %d: %s", c.startLine+1, err)
+					continue
+				}
+			}
+			formatted = splitCellIntoLines(strings.TrimRight(formatSparkSqlStrings(source, sqlOptions, tabSize), "\r\n"))
+		}
+
+		edits = append(edits, lineEdits(start, body, formatted, newline)...)
+	}
+
+	return edits
+}
+
+// formattableLines returns the code of a Python or %sql cell and the document
+// line it starts on. The notebook header, the cell title and the blank lines
+// around the code are left out. Python cells must not hold magic lines and
+// %sql cells must hold nothing else.
+func (c cell) formattableLines() (int, []string) {
+	if c.language != "python" && c.language != "sql" {
+		return 0, nil
+	}
+
+	var lines []string
+	for _, line := range c.lines {
+		line = strings.TrimRight(line, "\r")
+		_, _, isMagic := magicContent(line)
+		blank := strings.TrimSpace(line) == "" || isHeaderLine(line) || isTitleLine(line)
+		if !blank && isMagic != (c.language == "sql") {
+			return 0, nil
+		}
+		lines = append(lines, line)
+	}
+
+	first := 0
+	for first < len(lines) && (strings.TrimSpace(lines[first]) == "" || isHeaderLine(lines[first]) || isTitleLine(lines[first])) {
+		first++
+	}
+	last := len(lines)
+	for last > first && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+
+	return c.startLine + first, lines[first:last]
+}
+
+// lineEdits turns the difference between the old and formatted lines of a cell
+// into one edit per changed run of lines.
+func lineEdits(start int, old, formatted []string, newline string) []lsp.TextEdit {
+	var edits []lsp.TextEdit
+
+	// common[i][j] is the length of the longest common subsequence of
+	// old[i:] and formatted[j:].
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(formatted)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(formatted) - 1; j >= 0; j-- {
+			if old[i] == formatted[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(formatted) {
+		if i < len(old) && j < len(formatted) && old[i] == formatted[j] {
+			i++
+			j++
+			continue
+		}
+
+		oldStart, newStart := i, j
+		for (i < len(old) || j < len(formatted)) && !(i < len(old) && j < len(formatted) && old[i] == formatted[j]) {
+			if i == len(old) || (j < len(formatted) && common[i][j+1] >= common[i+1][j]) {
+				j++
+			} else {
+				i++
+			}
+		}
+		edits = append(edits, lineEdit(start, old, oldStart, i, formatted[newStart:j], newline))
+	}
+
+	return edits
+}
+
+// lineEdit replaces old[from:to] with the given lines. Edits end within the
+// cell unless every line is removed, so the cell may end the document.
+func lineEdit(start int, old []string, from, to int, lines []string, newline string) lsp.TextEdit {
+	text := strings.Join(lines, newline)
+
+	switch {
+	case from == to && from < len(old):
+		return textEdit(start+from, 0, start+from, 0, text+newline)
+	case from == to:
+		return textEdit(start+from-1, len(old[from-1]), start+from-1, len(old[from-1]), newline+text)
+	case len(lines) == 0 && from > 0:
+		return textEdit(start+from-1, len(old[from-1]), start+to-1, len(old[to-1]), "")
+	case len(lines) == 0:
+		return textEdit(start, 0, start+to, 0, "")
+	}
+	return textEdit(start+from, 0, start+to-1, len(old[to-1]), text)
+}
+
+func textEdit(line, char, endLine, endChar int, text string) lsp.TextEdit {
+	return lsp.TextEdit{
+		Range: lsp.Range{
+			StartPosition: lsp.Position{Line: line, Character: char},
+			EndPosition:   lsp.Position{Line: endLine, Character: endChar},
+		},
+		NewText: text,
+	}
+}
@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"strings"
+	"testing"
+)
+
+const unformattedNotebook = `# Databricks notebook source
+import os
+x=1
+
+
+y = 2
+
+# COMMAND ----------
+
+# DBTITLE 1,Load
+# MAGIC %sql
+# MAGIC SELECT  1
+
+# COMMAND ----------
+
+# DBTITLE 1,Compute
+def f( a ):
+  return a`
+
+const formattedNotebook = `# Databricks notebook source
+import os
+
+x = 1
+
+
+y = 2
+
+# COMMAND ----------
+
+# DBTITLE 1,Load
+# MAGIC %sql
+# MAGIC SELECT 1
+
+# COMMAND ----------
+
+# DBTITLE 1,Compute
+def f(a):
+    return a`
+
+// fakeFormat spaces out assignments and calls and indents by four, which is
+// enough of ruff format for these tests.
+func fakeFormat(source string) (string, error) {
+	replacer := strings.NewReplacer("x=1", "x = 1", "f( a )", "f(a)", "  return", "    return", "import os\n", "import os\n\n")
+	return replacer.Replace(source), nil
+}
+
+// applyTextEdits applies edits that do not overlap to a document.
+func applyTextEdits(doc string, edits []lsp.TextEdit) string {
+	lines := splitCellIntoLines(doc)
+	offset := func(p lsp.Position) int {
+		total := 0
+		for _, line := range lines[:p.Line] {
+			total += len(line) + 1
+		}
+		return total + p.Character
+	}
+
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		doc = doc[:offset(edit.Range.StartPosition)] + edit.NewText + doc[offset(edit.Range.EndPosition):]
+	}
+	return doc
+}
+
+func TestFormattingPerCell(t *testing.T) {
+	logger := log.New(os.Stderr, "", 0)
+
+	edits := formatCells(unformattedNotebook, nil, fakeFormat, lsp.SQLFormatOptions{}, 4, logger)
+	if len(edits) != 3 {
+		t.Fatalf("Expected one edit per changed run of lines, Got: %+v", edits)
+	}
+	if got := applyTextEdits(unformattedNotebook, edits); got != formattedNotebook {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", formattedNotebook, got)
+	}
+
+	cursor := lsp.Range{StartPosition: lsp.Position{Line: 17}, EndPosition: lsp.Position{Line: 17}}
+	edits = formatCells(unformattedNotebook, &cursor, fakeFormat, lsp.SQLFormatOptions{}, 4, logger)
+	if len(edits) != 1 || edits[0].Range.StartPosition.Line != 16 || edits[0].NewText != "def f(a):\n    return a" {
+		t.Fatalf("Expected only the cell under the cursor to be formatted, Got: %+v", edits)
+	}
+}
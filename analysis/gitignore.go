@@ -0,0 +1,163 @@
+package analysis
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitignoreRule is one pattern of a .gitignore file. Patterns apply below the
+// folder of their file, given as a slash separated path from the workspace
+// root.
+type gitignoreRule struct {
+	base     string
+	pattern  *regexp.Regexp
+	anchored bool
+	negate   bool
+	dirOnly  bool
+}
+
+// parseGitignore reads the patterns of a .gitignore file in the given folder.
+func parseGitignore(base, content string) []gitignoreRule {
+	var rules []gitignoreRule
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := gitignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A malformed pattern, such as a reversed range, is skipped.
+		pattern, err := regexp.Compile("^" + globRegexp(strings.TrimPrefix(line, "/")) + "$")
+		if err != nil {
+			continue
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// globRegexp turns a gitignore glob into a regular expression. A "**"
+// segment matches any number of folders.
+func globRegexp(glob string) string {
+	var expr strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			expr.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		case glob[i] == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case glob[i] == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	return expr.String()
+}
+
+// gitignored reports whether a path, relative to the workspace root, is
+// ignored. The last rule that matches decides, as in git.
+func gitignored(rules []gitignoreRule, rel string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			name = rel[len(rule.base)+1:]
+		}
+		if !rule.anchored {
+			name = path.Base(name)
+		}
+
+		if rule.pattern.MatchString(name) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// readGitignore reads the rules of the .gitignore file in a folder, if any.
+func readGitignore(root, rel string) []gitignoreRule {
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel), ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	return parseGitignore(rel, string(content))
+}
+
+// ancestorGitignores reads the rules that apply to a path, from the .gitignore
+// files of the root and every folder above the path, and reports whether one
+// of those folders is ignored itself.
+func ancestorGitignores(root, rel string) ([]gitignoreRule, bool) {
+	rules := readGitignore(root, "")
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		folder := strings.Join(parts[:i], "/")
+		if skippedFolder(parts[i-1]) || gitignored(rules, folder, true) {
+			return rules, true
+		}
+		rules = append(rules, readGitignore(root, folder)...)
+	}
+
+	return rules, false
+}
+
+// skippedFolder reports whether a folder is never indexed. Hidden folders hold
+// version control data, virtual environments and the server's own lint files.
+func skippedFolder(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"encoding/json"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"strings"
+	"testing"
+)
+
+const hoverNotebook = `# Databricks notebook source
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC CREATE TABLE orders AS SELECT date_add(order_date, 1) FROM raw`
+
+func TestHoverSqlFunction(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", hoverNotebook)
+
+	response := state.Hover(1, "file:///nb.py", lsp.Position{Line: 4, Character: 40}, log.New(os.Stderr, "", 0))
+	if response.Result == nil {
+		t.Fatal("Expected hover for date_add")
+	}
+	if !strings.HasPrefix(response.Result.Contents.Value, "```sql\ndate_add(startDate DATE, numDays INT) -> DATE") {
+		t.Fatalf("Expected date_add signature, Got: %s", response.Result.Contents.Value)
+	}
+}
+
+func TestHoverSqlKeywordPhrase(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", hoverNotebook)
+
+	response := state.Hover(1, "file:///nb.py", lsp.Position{Line: 4, Character: 17}, log.New(os.Stderr, "", 0))
+	if response.Result == nil || !strings.HasPrefix(response.Result.Contents.Value, "```sql\nCREATE [ OR REPLACE ] TABLE") {
+		t.Fatalf("Expected CREATE TABLE syntax, Got: %+v", response.Result)
+	}
+}
+
+func TestHoverWithoutContentIsNull(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", hoverNotebook)
+
+	response := state.Hover(1, "file:///nb.py", lsp.Position{Line: 0, Character: 3}, log.New(os.Stderr, "", 0))
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"result":null`) {
+		t.Fatalf("Expected a null result, Got: %s", encoded)
+	}
+}
+
+func TestHoverListsEveryDiagnostic(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\nimport os\nx: int = \"a\"\n")
+
+	messages, err := parseRuffResults(`[{"code":"F401","message":"` + "`os`" + ` imported but unused","location":{"row":2,"column":8},"end_location":{"row":2,"column":10},"url":"https://docs.astral.sh/ruff/rules/unused-import"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages = append(messages, parseTypeResults(".temp_nb.py:2:8: error: Library stubs not installed  [import-untyped]\n.temp_nb.py:3:10: error: Incompatible types  [assignment]")...)
+	fillEndPosition(messages, state.Documents["file:///nb.py"])
+	state.LinterResults["file:///nb.py"] = messages
+
+	response := state.Hover(1, "file:///nb.py", lsp.Position{Line: 1, Character: 8}, log.New(os.Stderr, "", 0))
+	if response.Result == nil {
+		t.Fatal("Expected hover for diagnostics")
+	}
+
+	value := response.Result.Contents.Value
+	if response.Result.Contents.Kind != lsp.MarkupKindMarkdown || strings.Count(value, "\n---\n") != 1 {
+		t.Fatalf("Expected two markdown entries, Got: %s", value)
+	}
+	if !strings.Contains(value, "`F401` (Ruff)") || !strings.Contains(value, "error_code_list.html#code-import-untyped") {
+		t.Fatalf("Expected ruff and mypy entries with links, Got: %s", value)
+	}
+}
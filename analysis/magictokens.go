@@ -0,0 +1,313 @@
+package analysis
+
+import (
+	"myfirstlsp/lsp"
+	"strings"
+	"unicode"
+)
+
+var shellKeywords = map[string]bool{
+	"if":       true,
+	"then":     true,
+	"else":     true,
+	"elif":     true,
+	"fi":       true,
+	"for":      true,
+	"while":    true,
+	"until":    true,
+	"do":       true,
+	"done":     true,
+	"case":     true,
+	"esac":     true,
+	"in":       true,
+	"function": true,
+	"select":   true,
+	"return":   true,
+	"exit":     true,
+	"export":   true,
+	"local":    true,
+	"readonly": true,
+	"unset":    true,
+	"set":      true,
+	"source":   true,
+}
+
+func newToken(value string, lineNo, startIndex, tokenType int) token {
+	modifiers := 0
+	return token{
+		tokenValue:     value,
+		absLineNo:      lineNo,
+		absStartIndex:  startIndex,
+		length:         len(value),
+		tokenType:      &tokenType,
+		tokenModifiers: &modifiers,
+	}
+}
+
+// findMarkerTokens tags the notebook source markers so that themes can dim them.
+func findMarkerTokens(doc string) []token {
+	var tokenList []token
+
+	for i, line := range splitCellIntoLines(doc) {
+		line = strings.TrimRight(line, "\r")
+
+		switch {
+		case isCommandSeparator(line), isHeaderLine(line):
+			tokenList = append(tokenList, newToken(line, i, 0, lsp.TokenComment))
+		case isTitleLine(line):
+			tokenList = append(tokenList, newToken(line, i, 0, lsp.TokenDecorator))
+		default:
+			if _, _, isMagic := magicContent(line); isMagic {
+				tokenList = append(tokenList, newToken(line[:len(magicPrefix)], i, 0, lsp.TokenComment))
+			}
+		}
+	}
+
+	return tokenList
+}
+
+// findMagicCellTokens returns the tokens for the non-SQL magic cells.
+func findMagicCellTokens(c cell) []token {
+	var tokenList []token
+	inFence := false
+	seenCommand := false
+
+	for i, line := range c.lines {
+		content, offset, isMagic := magicContent(line)
+		if !isMagic {
+			continue
+		}
+		lineNo := c.startLine + i
+
+		if !seenCommand && strings.HasPrefix(strings.TrimSpace(content), "%") {
+			seenCommand = true
+			tokenList = append(tokenList, findCommandTokens(content, lineNo, offset)...)
+			continue
+		}
+
+		switch c.language {
+		case "md":
+			var lineTokens []token
+			lineTokens, inFence = findMarkdownTokens(content, lineNo, offset, inFence)
+			tokenList = append(tokenList, lineTokens...)
+		case "sh":
+			tokenList = append(tokenList, findShellTokens(content, lineNo, offset)...)
+		}
+	}
+
+	return tokenList
+}
+
+// findCommandTokens tokenises the line holding the magic command, giving
+// %run and %pip their arguments as well.
+func findCommandTokens(content string, lineNo, offset int) []token {
+	var tokenList []token
+
+	words := splitWordsWithPosition(content)
+	if len(words) == 0 {
+		return tokenList
+	}
+
+	command := words[0]
+	tokenList = append(tokenList, newToken(command.value, lineNo, offset+command.start, lsp.TokenMacro))
+
+	for j, word := range words[1:] {
+		tokenType := lsp.TokenString
+
+		switch strings.ToLower(command.value) {
+		case "%run":
+			if j > 0 {
+				tokenType = lsp.TokenParameter
+			}
+		case "%pip":
+			if j == 0 {
+				tokenType = lsp.TokenKeyword
+			} else if strings.HasPrefix(word.value, "-") {
+				tokenType = lsp.TokenParameter
+			}
+		default:
+			return tokenList
+		}
+
+		tokenList = append(tokenList, newToken(word.value, lineNo, offset+word.start, tokenType))
+	}
+
+	return tokenList
+}
+
+type positionedWord struct {
+	value string
+	start int
+}
+
+func splitWordsWithPosition(line string) []positionedWord {
+	var words []positionedWord
+	start := -1
+
+	for i, char := range line {
+		if unicode.IsSpace(char) {
+			if start != -1 {
+				words = append(words, positionedWord{value: line[start:i], start: start})
+				start = -1
+			}
+		} else if start == -1 {
+			start = i
+		}
+	}
+
+	if start != -1 {
+		words = append(words, positionedWord{value: line[start:], start: start})
+	}
+
+	return words
+}
+
+func findMarkdownTokens(content string, lineNo, offset int, inFence bool) ([]token, bool) {
+	var tokenList []token
+	trimmed := strings.TrimSpace(content)
+
+	if strings.HasPrefix(trimmed, "```") {
+		tokenList = append(tokenList, newToken(content, lineNo, offset, lsp.TokenMarkdownCode))
+		return tokenList, !inFence
+	}
+
+	if inFence {
+		if content != "" {
+			tokenList = append(tokenList, newToken(content, lineNo, offset, lsp.TokenMarkdownCode))
+		}
+		return tokenList, inFence
+	}
+
+	if isMarkdownHeading(trimmed) {
+		start := strings.Index(content, trimmed)
+		tokenList = append(tokenList, newToken(trimmed, lineNo, offset+start, lsp.TokenMarkdownHeading))
+		return tokenList, inFence
+	}
+
+	i := 0
+	for i < len(content) {
+		length, tokenType := markdownSpanAt(content, i)
+		if length > 0 {
+			tokenList = append(tokenList, newToken(content[i:i+length], lineNo, offset+i, tokenType))
+			i += length
+			continue
+		}
+		i++
+	}
+
+	return tokenList, inFence
+}
+
+func isMarkdownHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 {
+		return false
+	}
+	return len(line) == level || line[level] == ' '
+}
+
+// markdownSpanAt returns the length and type of an inline code span, link or
+// emphasis starting at index i, or zero if there is none.
+func markdownSpanAt(content string, i int) (int, int) {
+	switch content[i] {
+	case '`':
+		end := strings.IndexByte(content[i+1:], '`')
+		if end >= 0 {
+			return end + 2, lsp.TokenMarkdownCode
+		}
+	case '[':
+		textEnd := strings.Index(content[i:], "](")
+		if textEnd >= 0 {
+			urlEnd := strings.IndexByte(content[i+textEnd:], ')')
+			if urlEnd >= 0 {
+				return textEnd + urlEnd + 1, lsp.TokenMarkdownLink
+			}
+		}
+	case '*', '_':
+		if content[i] == '_' && i > 0 && isWordChar(rune(content[i-1])) {
+			return 0, 0
+		}
+
+		delimiter := content[i : i+1]
+		if strings.HasPrefix(content[i:], strings.Repeat(delimiter, 2)) {
+			delimiter = strings.Repeat(delimiter, 2)
+		}
+
+		end := strings.Index(content[i+len(delimiter):], delimiter)
+		if end > 0 {
+			return end + 2*len(delimiter), lsp.TokenMarkdownEmphasis
+		}
+	}
+	return 0, 0
+}
+
+func findShellTokens(content string, lineNo, offset int) []token {
+	var tokenList []token
+
+	i := 0
+	for i < len(content) {
+		char := content[i]
+
+		switch {
+		case char == '#' && (i == 0 || content[i-1] == ' '):
+			tokenList = append(tokenList, newToken(content[i:], lineNo, offset+i, lsp.TokenComment))
+			return tokenList
+
+		case char == '"' || char == '\'':
+			end := strings.IndexByte(content[i+1:], char)
+			if end < 0 {
+				end = len(content) - i - 2
+			}
+			tokenList = append(tokenList, newToken(content[i:i+end+2], lineNo, offset+i, lsp.TokenString))
+			i += end + 2
+
+		case char == '$':
+			length := shellVariableLength(content[i:])
+			tokenList = append(tokenList, newToken(content[i:i+length], lineNo, offset+i, lsp.TokenVariable))
+			i += length
+
+		case isWordChar(rune(char)):
+			end := i
+			for end < len(content) && isWordChar(rune(content[end])) {
+				end++
+			}
+			word := content[i:end]
+			if shellKeywords[word] && (i == 0 || !isPathChar(content[i-1])) {
+				tokenList = append(tokenList, newToken(word, lineNo, offset+i, lsp.TokenKeyword))
+			}
+			i = end
+
+		default:
+			i++
+		}
+	}
+
+	return tokenList
+}
+
+func shellVariableLength(text string) int {
+	if strings.HasPrefix(text, "${") {
+		end := strings.IndexByte(text, '}')
+		if end >= 0 {
+			return end + 1
+		}
+		return len(text)
+	}
+
+	length := 1
+	for length < len(text) && isWordChar(rune(text[length])) {
+		length++
+	}
+	if length == 1 && len(text) > 1 && strings.ContainsRune("@*#?$!0123456789", rune(text[1])) {
+		length = 2
+	}
+	return length
+}
+
+func isWordChar(char rune) bool {
+	return char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char)
+}
+
+func isPathChar(char byte) bool {
+	return char == '-' || char == '.' || char == '/'
+}
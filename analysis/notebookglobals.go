@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	_ "embed"
+	"myfirstlsp/lsp"
+	"regexp"
+	"strings"
+)
+
+//go:embed data/notebook_globals.py
+var notebookGlobalsStub string
+
+var (
+	notebookGlobalFunction = regexp.MustCompile(`^def\s+([A-Za-z]\w*)(\(.*\)\s*->\s*[^:]+)`)
+	notebookGlobalVariable = regexp.MustCompile(`^([A-Za-z]\w*)\s*=\s*_typing\.cast\((\w+)`)
+	privateStubPrefix      = regexp.MustCompile(`\b_(typing\.)?`)
+)
+
+// notebookGlobal is a name that Databricks defines in every notebook.
+type notebookGlobal struct {
+	name   string
+	detail string
+	kind   int
+}
+
+var notebookGlobals = loadNotebookGlobals(notebookGlobalsStub)
+
+// loadNotebookGlobals reads the public names declared at the top level of the
+// notebook globals stub.
+func loadNotebookGlobals(stub string) []notebookGlobal {
+	var globals []notebookGlobal
+
+	for _, line := range strings.Split(stub, "\n") {
+		if match := notebookGlobalFunction.FindStringSubmatch(line); match != nil {
+			globals = append(globals, notebookGlobal{
+				name:   match[1],
+				detail: match[1] + privateStubPrefix.ReplaceAllString(strings.TrimSpace(match[2]), ""),
+				kind:   lsp.CompletionItemKindFunction,
+			})
+		} else if match := notebookGlobalVariable.FindStringSubmatch(line); match != nil {
+			globals = append(globals, notebookGlobal{
+				name:   match[1],
+				detail: privateStubPrefix.ReplaceAllString(match[2], ""),
+				kind:   lsp.CompletionItemKindVariable,
+			})
+		}
+	}
+
+	return globals
+}
+
+// notebookGlobalsBlock returns the stub as an "if True:" block, ready to be
+// put at the top of the lint file without moving the notebook's imports away
+// from the top of the file. The dbutils protocols are generated from the
+// dbutils model.
+func notebookGlobalsBlock() []string {
+	block := []string{"if True:"}
+	for _, line := range strings.Split(strings.TrimRight(notebookGlobalsStub, "\n"), "\n") {
+		if line == dbutilsStubMarker {
+			for _, protocol := range dbutilsAPI.protocols(dbutilsProtocolPrefix) {
+				block = append(block, runBlockIndent+protocol)
+			}
+			continue
+		}
+		block = append(block, runBlockIndent+line)
+	}
+	return block
+}
+
+// pythonCompletionItems offers widget names inside dbutils.widgets.get, the
+// dbutils members after "dbutils.", and otherwise the notebook globals, in the
+// Python cells of a notebook.
+func pythonCompletionItems(doc string, position lsp.Position) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+
+	line, ok := pythonLineAt(doc, position.Line)
+	if !ok {
+		return items
+	}
+
+	textBefore := line[:min(position.Character, len(line))]
+	if widgetItems, ok := widgetCompletionItems(doc, textBefore); ok {
+		return widgetItems
+	}
+	if dbutilsItems, ok := dbutilsCompletionItems(textBefore); ok {
+		return dbutilsItems
+	}
+	if inPythonString(textBefore) {
+		return items
+	}
+
+	start, _ := wordBounds(line, position.Character)
+	if start > 0 && line[start-1] == '.' {
+		return items
+	}
+
+	for _, global := range notebookGlobals {
+		items = append(items, lsp.CompletionItem{
+			Label:  global.name,
+			Kind:   global.kind,
+			Detail: global.detail,
+		})
+	}
+
+	return items
+}
+
+// pythonLineAt returns a line of a notebook if it is Python code.
+func pythonLineAt(doc string, lineNo int) (string, bool) {
+	c, ok := cellAt(doc, lineNo)
+	if !ok || c.language != "python" {
+		return "", false
+	}
+
+	line := strings.TrimRight(c.lines[lineNo-c.startLine], "\r")
+	if _, _, isMagic := magicContent(line); isMagic {
+		return "", false
+	}
+	return line, true
+}
+
+// pythonTextBeforePosition returns the Python cell text written before the
+// cursor.
+func pythonTextBeforePosition(doc string, position lsp.Position) (string, bool) {
+	line, ok := pythonLineAt(doc, position.Line)
+	if !ok {
+		return "", false
+	}
+
+	c, _ := cellAt(doc, position.Line)
+	lines := append([]string{}, c.lines[:position.Line-c.startLine]...)
+	lines = append(lines, line[:min(position.Character, len(line))])
+
+	return strings.Join(lines, "\n"), true
+}
+
+// inPythonString reports whether a line ends inside a string literal.
+func inPythonString(text string) bool {
+	var quote byte
+
+	for i := 0; i < len(text); i++ {
+		switch char := text[i]; {
+		case quote != 0 && char == '\\':
+			i++
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote == 0 && (char == '"' || char == '\''):
+			quote = char
+		case quote == 0 && char == '#':
+			return false
+		}
+	}
+
+	return quote != 0
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"myfirstlsp/lsp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// DocumentDiagnostics answers a pull for the diagnostics of an open document.
+// When they are the same as the ones the client holds under its previous
+// result ID, the report says so instead of repeating them.
+func (s *State) DocumentDiagnostics(id int, uri, previousResultID string, logger *log.Logger) *lsp.DocumentDiagnosticResponse {
+
+	response := lsp.DocumentDiagnosticResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	report := fullDiagnosticReport(s.reportedMessages(uri))
+	if report.ResultID == previousResultID {
+		logger.Printf("Diagnostics of %s are unchanged", uri)
+		response.Result = unchangedDiagnosticReport(report.ResultID)
+	} else {
+		logger.Printf("Reported %d diagnostics of %s", len(report.Items), uri)
+		response.Result = report
+	}
+
+	return &response
+}
+
+// diagnosedNotebook is the last report of an unopened notebook, with the
+// content and the workspace checks it was made from.
+type diagnosedNotebook struct {
+	content string
+	checks  string
+	report  lsp.FullDocumentDiagnosticReport
+}
+
+// WorkspaceDiagnostics answers a pull for the diagnostics of the indexed
+// notebooks that are not open. Only the server's own checks run on them, as
+// the linters work on the open documents; open documents are reported by
+// DocumentDiagnostics. A notebook is only checked again when its content, the
+// catalog or the tables created in the workspace have changed.
+func (s *State) WorkspaceDiagnostics(id int, previous []lsp.PreviousResultID, logger *log.Logger) *lsp.WorkspaceDiagnosticResponse {
+
+	previousIDs := map[string]string{}
+	for _, p := range previous {
+		previousIDs[p.URI] = p.Value
+	}
+
+	notebooks := s.index.indexedNotebooks()
+	uris := make([]string, 0, len(notebooks))
+	for uri := range notebooks {
+		if _, open := s.Documents[uri]; !open {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+
+	if s.diagnosed == nil {
+		s.diagnosed = map[string]diagnosedNotebook{}
+	}
+	checks := s.workspaceChecks()
+
+	items := []any{}
+	checked := 0
+	for _, uri := range uris {
+		content := notebooks[uri].content
+		diagnosed, found := s.diagnosed[uri]
+		if !found || diagnosed.content != content || diagnosed.checks != checks {
+			diagnosed = diagnosedNotebook{
+				content: content,
+				checks:  checks,
+				report:  fullDiagnosticReport(s.notebookMessages(content, nil)),
+			}
+			s.diagnosed[uri] = diagnosed
+			checked++
+		}
+
+		if diagnosed.report.ResultID == previousIDs[uri] {
+			items = append(items, lsp.WorkspaceUnchangedDocumentDiagnosticReport{
+				UnchangedDocumentDiagnosticReport: unchangedDiagnosticReport(diagnosed.report.ResultID),
+				URI:                               uri,
+			})
+		} else {
+			items = append(items, lsp.WorkspaceFullDocumentDiagnosticReport{
+				FullDocumentDiagnosticReport: diagnosed.report,
+				URI:                          uri,
+			})
+		}
+	}
+
+	for uri := range s.diagnosed {
+		_, open := s.Documents[uri]
+		if _, found := notebooks[uri]; !found || open {
+			delete(s.diagnosed, uri)
+		}
+	}
+	logger.Printf("Reported diagnostics of %d unopened notebooks, %d checked again", len(items), checked)
+
+	response := lsp.WorkspaceDiagnosticResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: lsp.WorkspaceDiagnosticReport{Items: items},
+	}
+
+	return &response
+}
+
+// workspaceChecks describes what the checks of a notebook depend on besides
+// its content: the catalog file and the tables created in the workspace.
+func (s *State) workspaceChecks() string {
+	cat := s.currentCatalog()
+	if cat == nil {
+		return ""
+	}
+
+	names := maps.Keys(s.definedTableNames())
+	sort.Strings(names)
+	return cat.path + "@" + cat.modTime.String() + "\n" + strings.Join(names, "\n")
+}
+
+// fullDiagnosticReport lists the diagnostics of the messages under a result
+// ID made from them.
+func fullDiagnosticReport(messages []errorMessage) lsp.FullDocumentDiagnosticReport {
+	diagnostics := []lsp.Diagnostic{}
+	for _, msg := range messages {
+		diagnostics = append(diagnostics, msg.diagnostic())
+	}
+
+	return lsp.FullDocumentDiagnosticReport{
+		Kind:     lsp.DocumentDiagnosticReportKindFull,
+		ResultID: diagnosticsResultID(diagnostics),
+		Items:    diagnostics,
+	}
+}
+
+func unchangedDiagnosticReport(resultID string) lsp.UnchangedDocumentDiagnosticReport {
+	return lsp.UnchangedDocumentDiagnosticReport{Kind: lsp.DocumentDiagnosticReportKindUnchanged, ResultID: resultID}
+}
+
+// diagnosticsResultID identifies a set of diagnostics by their content, so
+// that the same diagnostics always get the same result ID.
+func diagnosticsResultID(diagnostics []lsp.Diagnostic) string {
+	data, _ := json.Marshal(diagnostics)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
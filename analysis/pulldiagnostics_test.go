@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"encoding/json"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const undeclaredWidgetNotebook = "# Databricks notebook source\nday = dbutils.widgets.get(\"day\")\n"
+
+func TestDocumentDiagnostics(t *testing.T) {
+	state := NewState()
+	uri := "file:///daily.py"
+	state.OpenDocument(uri, undeclaredWidgetNotebook)
+	logger := log.New(os.Stderr, "", 0)
+
+	full, ok := state.DocumentDiagnostics(1, uri, "", logger).Result.(lsp.FullDocumentDiagnosticReport)
+	if !ok || full.Kind != lsp.DocumentDiagnosticReportKindFull || full.ResultID == "" || len(full.Items) != 1 || full.Items[0].Code != "undeclared-widget" {
+		t.Fatalf("Expected a full report of the undeclared widget, Got: %+v", full)
+	}
+
+	response := state.DocumentDiagnostics(1, uri, full.ResultID, logger)
+	unchanged, ok := response.Result.(lsp.UnchangedDocumentDiagnosticReport)
+	if !ok || unchanged.Kind != lsp.DocumentDiagnosticReportKindUnchanged || unchanged.ResultID != full.ResultID {
+		t.Fatalf("Expected an unchanged report, Got: %+v", response.Result)
+	}
+	encoded, _ := json.Marshal(response.Result)
+	if string(encoded) != `{"kind":"unchanged","resultId":"`+full.ResultID+`"}` {
+		t.Fatalf("Expected an unchanged report without items, Got: %s", encoded)
+	}
+
+	state.UpdateDocument(uri, "# Databricks notebook source\n")
+	fixed, ok := state.DocumentDiagnostics(1, uri, full.ResultID, logger).Result.(lsp.FullDocumentDiagnosticReport)
+	if !ok || fixed.ResultID == full.ResultID || fixed.Items == nil || len(fixed.Items) != 0 {
+		t.Fatalf("Expected an empty full report, Got: %+v", fixed)
+	}
+}
+
+func TestWorkspaceDiagnostics(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"daily.py", "weekly.py"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(undeclaredWidgetNotebook), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := log.New(os.Stderr, "", 0)
+
+	state := NewState()
+	state.WorkspaceRoot = root
+	state.index.scan(root)
+	state.OpenDocument(pathToURI(filepath.Join(root, "daily.py")), undeclaredWidgetNotebook)
+	weekly := pathToURI(filepath.Join(root, "weekly.py"))
+
+	items := state.WorkspaceDiagnostics(1, nil, logger).Result.Items
+	if len(items) != 1 {
+		t.Fatalf("Expected a report of weekly.py only, Got: %+v", items)
+	}
+	full, ok := items[0].(lsp.WorkspaceFullDocumentDiagnosticReport)
+	if !ok || full.URI != weekly || full.Version != nil || len(full.Items) != 1 {
+		t.Fatalf("Expected a full report of weekly.py, Got: %+v", items[0])
+	}
+
+	previous := []lsp.PreviousResultID{{URI: weekly, Value: full.ResultID}}
+	again := state.WorkspaceDiagnostics(1, previous, logger).Result.Items
+	if len(again) != 1 {
+		t.Fatalf("Expected a report of weekly.py only, Got: %+v", again)
+	}
+	if unchanged, ok := again[0].(lsp.WorkspaceUnchangedDocumentDiagnosticReport); !ok || unchanged.URI != weekly || unchanged.ResultID != full.ResultID {
+		t.Fatalf("Expected weekly.py unchanged, Got: %+v", again[0])
+	}
+
+	cached := state.diagnosed[weekly]
+	cached.report.ResultID = "cached"
+	state.diagnosed[weekly] = cached
+	reused := state.WorkspaceDiagnostics(1, []lsp.PreviousResultID{{URI: weekly, Value: "cached"}}, logger).Result.Items
+	if _, ok := reused[0].(lsp.WorkspaceUnchangedDocumentDiagnosticReport); !ok {
+		t.Fatalf("Expected the cached report to be reused, Got: %+v", reused[0])
+	}
+
+	state.index.update(weekly, &indexedNotebook{content: "# Databricks notebook source\n"})
+	changed := state.WorkspaceDiagnostics(1, []lsp.PreviousResultID{{URI: weekly, Value: "cached"}}, logger).Result.Items
+	if report, ok := changed[0].(lsp.WorkspaceFullDocumentDiagnosticReport); !ok || len(report.Items) != 0 {
+		t.Fatalf("Expected weekly.py checked again after it changed, Got: %+v", changed[0])
+	}
+}
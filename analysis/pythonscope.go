@@ -0,0 +1,328 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+)
+
+// pythonOperators are the operators longer than one character, longest first.
+var pythonOperators = []string{
+	"**=", "//=", ">>=", "<<=", "...",
+	"->", ":=", "==", "!=", "<=", ">=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@=", "**", "//", ">>", "<<",
+}
+
+var pythonAssignments = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "//=": true, "%=": true,
+	"**=": true, "@=": true, "&=": true, "|=": true, "^=": true, ">>=": true, "<<=": true,
+}
+
+// pythonParameterStarts are the tokens a parameter follows in a def or lambda.
+var pythonParameterStarts = map[string]bool{"(": true, ",": true, "*": true, "**": true, "lambda": true}
+
+// pythonToken is a name, operator or string in Python code. Comments are left
+// out and a string is kept as its opening quote, apart from the expressions
+// of f-strings, which are read as code.
+type pythonToken struct {
+	text    string
+	offset  int
+	name    bool
+	depth   int  // brackets open around the token
+	bracket byte // the innermost open bracket
+	header  bool // in the parameter list of a def
+	first   bool // starts a logical line
+	indent  int  // indentation of the logical line
+}
+
+func pythonTokens(text string) []pythonToken {
+	var tokens []pythonToken
+	var brackets []byte
+	var headers []bool
+	lineStart, newLine, indent := 0, true, 0
+
+	add := func(token pythonToken) {
+		token.depth = len(brackets)
+		if len(brackets) > 0 {
+			token.bracket = brackets[len(brackets)-1]
+			token.header = headers[len(headers)-1]
+		}
+		if newLine {
+			indent = token.offset - lineStart
+		}
+		token.first, token.indent, newLine = newLine, indent, false
+		tokens = append(tokens, token)
+	}
+
+	for i := 0; i < len(text); {
+		switch char := text[i]; {
+		case char == '\n':
+			i++
+			lineStart = i
+			newLine = newLine || len(brackets) == 0
+
+		case char == '\\':
+			i++
+			for i < len(text) && text[i] == '\r' {
+				i++
+			}
+			if i < len(text) && text[i] == '\n' {
+				i++
+			}
+
+		case char == ' ' || char == '\t' || char == '\r' || char == '\f':
+			i++
+
+		case char == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+
+		case char == '"' || char == '\'':
+			add(pythonToken{text: text[i : i+1], offset: i})
+			i = pythonStringEnd(text, i)
+
+		case isWordChar(rune(char)):
+			start := i
+			for i < len(text) && isWordChar(rune(text[i])) {
+				i++
+			}
+			word := text[start:i]
+
+			if i < len(text) && (text[i] == '"' || text[i] == '\'') && len(word) <= 2 && strings.Trim(word, "rRbBuUfF") == "" {
+				end := pythonStringEnd(text, i)
+				add(pythonToken{text: text[i : i+1], offset: start})
+				if strings.ContainsAny(word, "fF") {
+					tokens = append(tokens, fStringTokens(text, i, end, tokens[len(tokens)-1])...)
+				}
+				i = end
+				continue
+			}
+			add(pythonToken{text: word, offset: start, name: !unicode.IsDigit(rune(char))})
+
+		case strings.IndexByte("([{", char) >= 0:
+			header := char == '(' && len(tokens) >= 2 && tokens[len(tokens)-2].text == "def" && tokens[len(tokens)-1].name
+			add(pythonToken{text: text[i : i+1], offset: i})
+			brackets, headers = append(brackets, char), append(headers, header)
+			i++
+
+		case strings.IndexByte(")]}", char) >= 0:
+			if len(brackets) > 0 {
+				brackets, headers = brackets[:len(brackets)-1], headers[:len(headers)-1]
+			}
+			add(pythonToken{text: text[i : i+1], offset: i})
+			i++
+
+		default:
+			op := text[i : i+1]
+			for _, candidate := range pythonOperators {
+				if strings.HasPrefix(text[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			add(pythonToken{text: op, offset: i})
+			i += len(op)
+		}
+	}
+
+	return tokens
+}
+
+// fStringTokens reads the expressions between the braces of an f-string as
+// code, one bracket deeper than the string. Conversions and format specs are
+// left out, apart from the fields nested in them.
+func fStringTokens(text string, start, end int, str pythonToken) []pythonToken {
+	var tokens []pythonToken
+
+	quote := 1
+	if strings.HasPrefix(text[start:], strings.Repeat(text[start:start+1], 3)) {
+		quote = 3
+	}
+
+	for i := start + quote; i < end; i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case text[i] == '{' && i+1 < end && text[i+1] == '{':
+			i++
+		case text[i] == '{':
+			exprEnd := fStringExpressionEnd(text, i+1, end)
+			for _, token := range pythonTokens(text[i+1 : exprEnd]) {
+				token.offset += i + 1
+				token.depth += str.depth + 1
+				if token.bracket == 0 {
+					token.bracket = '{'
+				}
+				token.first, token.indent = false, str.indent
+				tokens = append(tokens, token)
+			}
+			i = exprEnd
+		}
+	}
+
+	return tokens
+}
+
+// fStringExpressionEnd returns the offset of the `}`, `!` or `:` that ends
+// the expression of an f-string field.
+func fStringExpressionEnd(text string, start, end int) int {
+	depth := 0
+	for i := start; i < end; i++ {
+		switch char := text[i]; {
+		case char == '"' || char == '\'':
+			i = min(pythonStringEnd(text, i), end) - 1
+		case strings.IndexByte("([{", char) >= 0:
+			depth++
+		case strings.IndexByte(")]}", char) >= 0:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case depth == 0 && (char == ':' || char == '!' && (i+1 >= end || text[i+1] != '=')):
+			return i
+		}
+	}
+	return end
+}
+
+// pythonScope is the body of a function or class. A name bound in it, and not
+// declared global, belongs to it.
+type pythonScope struct {
+	parent *pythonScope
+	class  bool
+	bound  bool
+	global bool
+}
+
+// owner is the scope a name read in the scope belongs to, or nil for the
+// module. Class bodies are not seen from the functions inside them.
+func (s *pythonScope) owner() *pythonScope {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.global {
+			return nil
+		}
+		if scope.class && scope != s {
+			continue
+		}
+		if scope.bound {
+			return scope
+		}
+	}
+	return nil
+}
+
+// pythonNameUse is a place a name is read or bound. Its scope is nil for the
+// module.
+type pythonNameUse struct {
+	offset  int
+	scope   *pythonScope
+	binding bool
+}
+
+// pythonNameUses finds a name in Python code, leaving out strings, comments,
+// attributes of other objects and keyword arguments, and tells the scope each
+// use belongs to. It fails when the name is a parameter of a lambda or the
+// target of a comprehension, whose scopes are not followed.
+func pythonNameUses(text, name string) ([]pythonNameUse, bool) {
+	tokens := pythonTokens(text)
+
+	type block struct {
+		scope  *pythonScope
+		indent int
+	}
+	var blocks []block
+	var pending *pythonScope
+	var uses []pythonNameUse
+
+	statement, assignment := "", -1
+	forTargets, imported := false, false
+
+	for i, token := range tokens {
+		if token.first {
+			for len(blocks) > 0 && blocks[len(blocks)-1].indent >= token.indent {
+				blocks = blocks[:len(blocks)-1]
+			}
+			pending, statement, assignment = nil, token.text, -1
+			forTargets, imported = false, false
+			for j := i; j < len(tokens) && (j == i || !tokens[j].first); j++ {
+				if tokens[j].depth == 0 && pythonAssignments[tokens[j].text] {
+					assignment = j
+				}
+			}
+		}
+
+		var current *pythonScope
+		if len(blocks) > 0 {
+			current = blocks[len(blocks)-1].scope
+		}
+		var prev, next pythonToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		switch {
+		case (token.text == "def" || token.text == "class") && token.depth == 0 && next.name:
+			pending = &pythonScope{parent: current, class: token.text == "class"}
+		case token.text == ":" && token.depth == 0 && pending != nil:
+			blocks = append(blocks, block{scope: pending, indent: token.indent})
+			pending = nil
+		case token.text == "lambda":
+			for j := i + 1; j < len(tokens) && !(tokens[j].text == ":" && tokens[j].depth == token.depth); j++ {
+				if tokens[j].text == name && tokens[j].depth == token.depth && pythonParameterStarts[tokens[j-1].text] {
+					return nil, false
+				}
+			}
+		case token.text == "for" && token.depth > 0:
+			for j := i + 1; j < len(tokens) && !(tokens[j].text == "in" && tokens[j].depth == token.depth); j++ {
+				if tokens[j].text == name {
+					return nil, false
+				}
+			}
+		case token.text == "for":
+			forTargets = true
+		case token.text == "in" && token.depth == 0:
+			forTargets = false
+		case token.text == "import":
+			imported = true
+		}
+
+		if !token.name || token.text != name || prev.text == "." {
+			continue
+		}
+		if next.text == "=" && token.bracket == '(' && !token.header {
+			continue
+		}
+
+		use := pythonNameUse{offset: token.offset, scope: current}
+		switch {
+		case token.header && pending != nil && token.depth == 1 && pythonParameterStarts[prev.text]:
+			use.scope, use.binding = pending, true
+		case token.header:
+		case statement == "global":
+			if current != nil {
+				current.global = true
+			}
+		case prev.text == "def" || prev.text == "class" || prev.text == "as" || next.text == ":=":
+			use.binding = true
+		case forTargets && token.depth == 0:
+			use.binding = true
+		case imported && (prev.text == "import" || prev.text == "," || prev.text == "(") && next.text != "as":
+			use.binding = true
+		case token.depth == 0 && i < assignment && next.text != "." && next.text != "[" && next.text != "(":
+			use.binding = true
+		case token.first && next.text == ":":
+			use.binding = true
+		}
+		if use.binding && use.scope != nil {
+			use.scope.bound = true
+		}
+		uses = append(uses, use)
+	}
+
+	for i := range uses {
+		uses[i].scope = uses[i].scope.owner()
+	}
+	return uses, true
+}
@@ -0,0 +1,437 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	pythonIdentifier = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+	plainSqlName     = regexp.MustCompile(`^[A-Za-z_]\w*(?:\.[A-Za-z_]\w*)*$`)
+)
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true, "def": true,
+	"del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// The kinds of name that can be renamed.
+const (
+	occurrenceKindPython = "Python name"
+	occurrenceKindWidget = "widget"
+	occurrenceKindTable  = "table"
+)
+
+// symbolOccurrence is a place a name is written. Names written in SQL may be
+// quoted with backticks.
+type symbolOccurrence struct {
+	uri         string
+	nameRange   lsp.Range
+	declaration bool
+	sql         bool
+	quoted      bool
+}
+
+func (s *State) References(id int, uri string, position lsp.Position, includeDeclaration bool, logger *log.Logger) *lsp.ReferencesResponse {
+
+	locations := []lsp.Location{}
+
+	occurrences, kind, _ := s.occurrencesAt(uri, position)
+	for _, occurrence := range occurrences {
+		if occurrence.declaration && !includeDeclaration {
+			continue
+		}
+		locations = append(locations, lsp.Location{URI: occurrence.uri, Range: occurrence.nameRange})
+	}
+	logger.Printf("Found %d references to a %s", len(locations), kind)
+
+	response := lsp.ReferencesResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: locations,
+	}
+
+	return &response
+}
+
+// Rename renames every occurrence of the name under the cursor. A temp view
+// or table is renamed in SQL, in temp view calls and in spark.table calls
+// alike. Names that are not valid for their kind are refused with an empty
+// result.
+func (s *State) Rename(id int, uri string, position lsp.Position, newName string, logger *log.Logger) *lsp.RenameResponse {
+
+	response := lsp.RenameResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	occurrences, kind, ok := s.occurrencesAt(uri, position)
+	if !ok {
+		logger.Printf("Nothing to rename at %d:%d", position.Line, position.Character)
+		return &response
+	}
+	if !validName(kind, newName) {
+		logger.Printf("%q is not a valid %s", newName, kind)
+		return &response
+	}
+
+	changes := map[string][]lsp.TextEdit{}
+	for _, occurrence := range occurrences {
+		text := newName
+		if occurrence.sql && (occurrence.quoted || !plainSqlName.MatchString(newName)) {
+			text = "`" + newName + "`"
+		}
+		changes[occurrence.uri] = append(changes[occurrence.uri], lsp.TextEdit{Range: occurrence.nameRange, NewText: text})
+	}
+	logger.Printf("Renaming %d occurrences of a %s in %d documents", len(occurrences), kind, len(changes))
+
+	response.Result = &lsp.WorkspaceEdit{Changes: changes}
+	return &response
+}
+
+func validName(kind, name string) bool {
+	switch kind {
+	case occurrenceKindPython:
+		return pythonIdentifier.MatchString(name) && !pythonKeywords[name]
+	case occurrenceKindWidget:
+		return name != "" && !strings.ContainsAny(name, "\"'\n")
+	case occurrenceKindTable:
+		return strings.TrimSpace(name) != "" && !strings.ContainsAny(name, "\"'`\n")
+	}
+	return false
+}
+
+// occurrencesAt finds the name under the cursor and everywhere it is written,
+// ordered by document and position. A widget name is looked for in the
+// widget calls of its notebook, a table name in the SQL and Spark calls of
+// every notebook in the workspace, and a Python name in its function or in
+// the notebooks that share its definition through %run.
+func (s *State) occurrencesAt(uri string, position lsp.Position) ([]symbolOccurrence, string, bool) {
+	doc := s.Documents[uri]
+
+	var occurrences []symbolOccurrence
+	var kind string
+
+	if name, ok := widgetNameAt(doc, position); ok {
+		occurrences, kind = widgetOccurrences(uri, doc, name), occurrenceKindWidget
+	} else if name, read, ok := s.tableNameAt(uri, position); ok {
+		if !read && len(s.tableDefinitionsAt(uri, position)) == 0 {
+			return nil, "", false
+		}
+		occurrences, kind = s.tableOccurrences(name), occurrenceKindTable
+	} else if name, ok := pythonNameAt(doc, position); ok {
+		if occurrences, ok = s.pythonOccurrences(uri, position, name); !ok {
+			return nil, "", false
+		}
+		kind = occurrenceKindPython
+	} else {
+		return nil, "", false
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		a, b := occurrences[i], occurrences[j]
+		if a.uri != b.uri {
+			return a.uri < b.uri
+		}
+		if a.nameRange.StartPosition.Line != b.nameRange.StartPosition.Line {
+			return a.nameRange.StartPosition.Line < b.nameRange.StartPosition.Line
+		}
+		return a.nameRange.StartPosition.Character < b.nameRange.StartPosition.Character
+	})
+	return occurrences, kind, true
+}
+
+// offset turns a position in the cell into an offset into its joined lines.
+func (c cell) offset(position lsp.Position) int {
+	offset := 0
+	for _, line := range c.lines[:position.Line-c.startLine] {
+		offset += len(line) + 1
+	}
+	return offset + position.Character
+}
+
+// widgetNameAt reads the widget name under the cursor in a widget declaration
+// or dbutils.widgets.get call.
+func widgetNameAt(doc string, position lsp.Position) (string, bool) {
+	if _, ok := pythonLineAt(doc, position.Line); !ok {
+		return "", false
+	}
+	c, _ := cellAt(doc, position.Line)
+	text := strings.Join(c.lines, "\n")
+	offset := c.offset(position)
+
+	for _, match := range widgetDeclaration.FindAllStringSubmatchIndex(text, -1) {
+		if offset >= match[4] && offset <= match[5] && !inPythonComment(text, match[0]) {
+			return text[match[4]:match[5]], true
+		}
+	}
+	for _, use := range findWidgetUses(c) {
+		if offset >= use.nameStart && offset <= use.nameEnd {
+			return use.name, true
+		}
+	}
+	return "", false
+}
+
+// widgetOccurrences lists the declarations and reads of a widget in a
+// notebook.
+func widgetOccurrences(uri, doc, name string) []symbolOccurrence {
+	var occurrences []symbolOccurrence
+
+	add := func(c cell, start, end int, declaration bool) {
+		occurrences = append(occurrences, symbolOccurrence{
+			uri: uri,
+			nameRange: lsp.Range{
+				StartPosition: c.sourcePosition(c.lines, start),
+				EndPosition:   c.sourcePosition(c.lines, end),
+			},
+			declaration: declaration,
+		})
+	}
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "python" {
+			continue
+		}
+		text := strings.Join(c.lines, "\n")
+
+		for _, match := range widgetDeclaration.FindAllStringSubmatchIndex(text, -1) {
+			if text[match[4]:match[5]] == name && !inPythonComment(text, match[0]) {
+				add(c, match[4], match[5], true)
+			}
+		}
+		for _, use := range findWidgetUses(c) {
+			if use.name == name {
+				add(c, use.nameStart, use.nameEnd, false)
+			}
+		}
+	}
+
+	return occurrences
+}
+
+// tableOccurrences lists where a table or view is created and read across
+// the workspace: CREATE statements, temp view and spark.table calls, and the
+// tables named after FROM and JOIN. Names match exactly, ignoring case.
+func (s *State) tableOccurrences(name string) []symbolOccurrence {
+	var occurrences []symbolOccurrence
+
+	for _, notebook := range s.parsedNotebooks() {
+		lines := splitCellIntoLines(notebook.content)
+
+		for _, definition := range notebook.tables {
+			if !strings.EqualFold(definition.name, name) {
+				continue
+			}
+			start := definition.nameRange.StartPosition
+			occurrences = append(occurrences, symbolOccurrence{
+				uri:         notebook.uri,
+				nameRange:   definition.nameRange,
+				declaration: true,
+				sql:         definition.sql,
+				quoted:      strings.HasPrefix(lines[start.Line][start.Character:], "`"),
+			})
+		}
+
+		sqlReferences := func(c cell, source []string, sql string, offset int) {
+			refs, _ := sqlStatementTables(sql)
+			for _, ref := range refs {
+				if !strings.EqualFold(strings.Join(ref.parts, "."), name) {
+					continue
+				}
+				occurrences = append(occurrences, symbolOccurrence{
+					uri: notebook.uri,
+					nameRange: lsp.Range{
+						StartPosition: c.sourcePosition(source, offset+ref.start),
+						EndPosition:   c.sourcePosition(source, offset+ref.end),
+					},
+					sql:    true,
+					quoted: strings.HasPrefix(sql[ref.start:], "`"),
+				})
+			}
+		}
+
+		for _, c := range splitIntoCells(notebook.content) {
+			switch c.language {
+			case "sql":
+				source := c.sqlSource()
+				sqlReferences(c, source, strings.Join(source, "\n"), 0)
+
+			case "python":
+				text := strings.Join(c.lines, "\n")
+				for _, span := range sparkSqlSpans(text) {
+					if !inPythonComment(text, span.start) {
+						sqlReferences(c, c.lines, span.sql, span.start)
+					}
+				}
+
+				for _, match := range sparkTableCall.FindAllStringSubmatchIndex(text, -1) {
+					if !strings.EqualFold(text[match[2]:match[3]], name) || inPythonComment(text, match[0]) {
+						continue
+					}
+					occurrences = append(occurrences, symbolOccurrence{
+						uri: notebook.uri,
+						nameRange: lsp.Range{
+							StartPosition: c.sourcePosition(c.lines, match[2]),
+							EndPosition:   c.sourcePosition(c.lines, match[3]),
+						},
+					})
+				}
+			}
+		}
+	}
+
+	return occurrences
+}
+
+// pythonNameAt reads the Python name under the cursor, outside of strings,
+// comments and keyword arguments.
+func pythonNameAt(doc string, position lsp.Position) (string, bool) {
+	line, ok := pythonLineAt(doc, position.Line)
+	if !ok {
+		return "", false
+	}
+	start, end := wordBounds(line, position.Character)
+	name := line[start:end]
+	if !pythonIdentifier.MatchString(name) || pythonKeywords[name] {
+		return "", false
+	}
+
+	c, _ := cellAt(doc, position.Line)
+	offset := c.offset(lsp.Position{Line: position.Line, Character: start})
+	uses, _ := pythonNameUses(strings.Join(c.lines, "\n"), name)
+	for _, use := range uses {
+		if use.offset == offset {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// pythonOccurrences lists where a Python name is written. A name that belongs
+// to a function or class stays in it. A name defined at the top level of a
+// notebook is followed into every notebook that reaches the same definition
+// through %run; any other name stays in its document. It fails when the
+// scope of the name cannot be told in one of those notebooks.
+func (s *State) pythonOccurrences(uri string, position lsp.Position, name string) ([]symbolOccurrence, bool) {
+	c, _ := cellAt(s.Documents[uri], position.Line)
+	uses, ok := pythonNameUses(strings.Join(c.lines, "\n"), name)
+	if !ok {
+		return nil, false
+	}
+	offset := c.offset(position)
+	for _, use := range uses {
+		if use.scope != nil && use.offset <= offset && offset <= use.offset+len(name) {
+			return localOccurrences(uri, c, name, uses, use.scope), true
+		}
+	}
+
+	scope := []string{uri}
+
+	definition, defined := s.findDefinition(uri, name, map[string]bool{})
+	if defined {
+		candidates := map[string]bool{uri: true, definition.URI: true}
+		for notebook, content := range s.workspaceNotebooks() {
+			if strings.Contains(content, name) {
+				candidates[notebook] = true
+			}
+		}
+
+		scope = nil
+		for candidate := range candidates {
+			if location, found := s.findDefinition(candidate, name, map[string]bool{}); found && location == definition {
+				scope = append(scope, candidate)
+			}
+		}
+	}
+
+	var occurrences []symbolOccurrence
+	for _, scoped := range scope {
+		doc, ok := s.documentContent(scoped)
+		if !ok {
+			continue
+		}
+
+		for _, c := range splitIntoCells(doc) {
+			if c.language != "python" {
+				continue
+			}
+			uses, ok := pythonNameUses(strings.Join(c.lines, "\n"), name)
+			if !ok {
+				return nil, false
+			}
+			for _, use := range uses {
+				if use.scope != nil {
+					continue
+				}
+				nameRange := lsp.Range{
+					StartPosition: c.sourcePosition(c.lines, use.offset),
+					EndPosition:   c.sourcePosition(c.lines, use.offset+len(name)),
+				}
+				occurrences = append(occurrences, symbolOccurrence{
+					uri:         scoped,
+					nameRange:   nameRange,
+					declaration: defined && scoped == definition.URI && nameRange == definition.Range,
+				})
+			}
+		}
+	}
+
+	return occurrences, true
+}
+
+// localOccurrences lists the uses of a name that belong to a function or
+// class. The first place it is bound is its declaration.
+func localOccurrences(uri string, c cell, name string, uses []pythonNameUse, scope *pythonScope) []symbolOccurrence {
+	var occurrences []symbolOccurrence
+
+	declared := false
+	for _, use := range uses {
+		if use.scope != scope {
+			continue
+		}
+		occurrences = append(occurrences, symbolOccurrence{
+			uri: uri,
+			nameRange: lsp.Range{
+				StartPosition: c.sourcePosition(c.lines, use.offset),
+				EndPosition:   c.sourcePosition(c.lines, use.offset+len(name)),
+			},
+			declaration: use.binding && !declared,
+		})
+		declared = declared || use.binding
+	}
+
+	return occurrences
+}
+
+// pythonStringEnd returns the offset after the string starting at an offset.
+// An unclosed single quoted string ends with its line.
+func pythonStringEnd(text string, start int) int {
+	quote := text[start : start+1]
+	if strings.HasPrefix(text[start:], quote+quote+quote) {
+		quote = text[start : start+3]
+	}
+
+	for i := start + len(quote); i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case strings.HasPrefix(text[i:], quote):
+			return i + len(quote)
+		case text[i] == '\n' && len(quote) == 1:
+			return i
+		}
+	}
+	return len(text)
+}
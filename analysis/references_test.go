@@ -0,0 +1,151 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const dailyNotebook = `# Databricks notebook source
+# MAGIC %run ../shared/config
+
+# COMMAND ----------
+
+dbutils.widgets.text("run_date", "")
+df = load_table("orders")  # load_table
+df.createOrReplaceTempView("recent")
+print(dbutils.widgets.get("run_date"), "load_table")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT * FROM recent r JOIN ` + "`recent`" + ` x
+`
+
+func TestReferencesAndRename(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("shared/config.py", "# Databricks notebook source\ndef load_table(name):\n    return spark.table(name)\n")
+	write("jobs/other.py", "# Databricks notebook source\ndef load_table(x):\n    pass\n\nrecent = spark.table(\"recent\")\n")
+	logger := log.New(os.Stderr, "", 0)
+
+	state := NewState()
+	state.WorkspaceRoot = root
+	state.index.scan(root)
+	uri := pathToURI(filepath.Join(root, "jobs", "daily.py"))
+	state.OpenDocument(uri, dailyNotebook)
+	configURI := pathToURI(filepath.Join(root, "shared", "config.py"))
+	otherURI := pathToURI(filepath.Join(root, "jobs", "other.py"))
+
+	references := state.References(1, uri, lsp.Position{Line: 6, Character: 8}, true, logger).Result
+	expected := []lsp.Location{
+		{URI: uri, Range: lsp.Range{StartPosition: lsp.Position{Line: 6, Character: 5}, EndPosition: lsp.Position{Line: 6, Character: 15}}},
+		{URI: configURI, Range: lsp.Range{StartPosition: lsp.Position{Line: 1, Character: 4}, EndPosition: lsp.Position{Line: 1, Character: 14}}},
+	}
+	if len(references) != len(expected) {
+		t.Fatalf("Expected %+v, Got: %+v", expected, references)
+	}
+	for _, location := range expected {
+		found := false
+		for _, reference := range references {
+			found = found || reference == location
+		}
+		if !found {
+			t.Errorf("Expected %+v in %+v", location, references)
+		}
+	}
+	if without := state.References(1, uri, lsp.Position{Line: 6, Character: 8}, false, logger).Result; len(without) != 1 || without[0].URI != uri {
+		t.Errorf("Expected only the call without the declaration, Got: %+v", without)
+	}
+
+	widget := state.Rename(1, uri, lsp.Position{Line: 8, Character: 30}, "day", logger).Result
+	if widget == nil || len(widget.Changes) != 1 || len(widget.Changes[uri]) != 2 {
+		t.Fatalf("Expected both widget names renamed, Got: %+v", widget)
+	}
+
+	view := state.Rename(1, uri, lsp.Position{Line: 13, Character: 24}, "recent orders", logger).Result
+	if view == nil {
+		t.Fatal("Expected the temp view renamed")
+	}
+	edits := view.Changes[uri]
+	if len(edits) != 3 || edits[0].NewText != "recent orders" || edits[0].Range.StartPosition != (lsp.Position{Line: 7, Character: 28}) ||
+		edits[1].NewText != "`recent orders`" || edits[1].Range.StartPosition != (lsp.Position{Line: 13, Character: 22}) ||
+		edits[2].NewText != "`recent orders`" || edits[2].Range.EndPosition != (lsp.Position{Line: 13, Character: 44}) {
+		t.Fatalf("Unexpected edits in daily.py: %+v", edits)
+	}
+	if other := view.Changes[otherURI]; len(other) != 1 || other[0].Range.StartPosition != (lsp.Position{Line: 4, Character: 22}) {
+		t.Fatalf("Expected the spark.table call in other.py renamed, Got: %+v", other)
+	}
+
+	if invalid := state.Rename(1, uri, lsp.Position{Line: 6, Character: 8}, "1st", logger).Result; invalid != nil {
+		t.Errorf("Expected no edit for an invalid name, Got: %+v", invalid)
+	}
+}
+
+func TestPythonNameUses(t *testing.T) {
+	text := "x = 1  # x\ny = f\"{x!r:>{x}}\" + '''x\nx''' + obj.x + x"
+	uses, ok := pythonNameUses(text, "x")
+	if !ok || len(uses) != 4 || uses[0].offset != 0 || uses[1].offset != 18 || uses[2].offset != 24 || uses[3].offset != len(text)-1 {
+		t.Fatalf("Expected x outside strings and in the f-string fields, Got: %+v", uses)
+	}
+
+	if _, ok := pythonNameUses("f = lambda x: x + 1", "x"); ok {
+		t.Error("Expected a lambda parameter to be refused")
+	}
+	if _, ok := pythonNameUses("ys = [x * 2 for x in xs]", "x"); ok {
+		t.Error("Expected a comprehension target to be refused")
+	}
+}
+
+func TestRenameKeepsPythonScopes(t *testing.T) {
+	doc := `# Databricks notebook source
+df = spark.range(3)
+
+def clean(df):
+    return df.dropna()
+
+def count():
+    global df
+    return df.count()
+
+show(df, df=1)
+print(f"{df}")
+`
+	state := NewState()
+	state.OpenDocument("file:///nb.py", doc)
+	logger := log.New(os.Stderr, "", 0)
+
+	starts := func(edit *lsp.WorkspaceEdit) string {
+		var positions []lsp.Position
+		for _, change := range edit.Changes["file:///nb.py"] {
+			positions = append(positions, change.Range.StartPosition)
+		}
+		return fmt.Sprint(positions)
+	}
+
+	global := state.Rename(1, "file:///nb.py", lsp.Position{Line: 1, Character: 0}, "frame", logger).Result
+	expected := []lsp.Position{{Line: 1, Character: 0}, {Line: 7, Character: 11}, {Line: 8, Character: 11}, {Line: 10, Character: 5}, {Line: 11, Character: 9}}
+	if global == nil || starts(global) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the module df renamed, Got: %+v", global)
+	}
+
+	parameter := state.Rename(1, "file:///nb.py", lsp.Position{Line: 4, Character: 12}, "frame", logger).Result
+	expected = []lsp.Position{{Line: 3, Character: 10}, {Line: 4, Character: 11}}
+	if parameter == nil || starts(parameter) != fmt.Sprint(expected) {
+		t.Fatalf("Expected only the parameter renamed, Got: %+v", parameter)
+	}
+
+	if keyword := state.Rename(1, "file:///nb.py", lsp.Position{Line: 10, Character: 10}, "frame", logger).Result; keyword != nil {
+		t.Fatalf("Expected nothing to rename on a keyword argument, Got: %+v", keyword)
+	}
+}
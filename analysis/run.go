@@ -0,0 +1,336 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pythonTopLevelName matches the functions, classes and variables defined at
+// the top level of a Python cell.
+var pythonTopLevelName = regexp.MustCompile(`^(?:(?:async\s+)?(?:def|class)\s+(\w+)|(\w+)\s*(?::[^=]*)?=[^=])`)
+
+// runBlockIndent indents the notebooks inlined for linting.
+const runBlockIndent = "    "
+
+// runNotebookExtensions are tried in turn, as %run paths leave out the
+// extension of the notebook source file.
+var runNotebookExtensions = []string{"", ".py"}
+
+// runInclude is a %run command and the position of the notebook path it names.
+type runInclude struct {
+	path  string
+	line  int
+	start int
+	end   int
+}
+
+func (s *State) Definition(id int, uri string, position lsp.Position, logger *log.Logger) *lsp.DefinitionResponse {
+
+	response := lsp.DefinitionResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	doc := s.Documents[uri]
+
+	for _, include := range findRunIncludes(doc) {
+		if include.line != position.Line || position.Character < include.start || position.Character > include.end {
+			continue
+		}
+		if target, ok := s.resolveRunPath(uri, include.path); ok {
+			response.Result = &lsp.Location{URI: target}
+		}
+		return &response
+	}
+
+	if definitions := s.tableDefinitionsAt(uri, position); len(definitions) > 0 {
+		logger.Printf("Found definition of table %s in %s", definitions[0].name, definitions[0].uri)
+		response.Result = &lsp.Location{URI: definitions[0].uri, Range: definitions[0].nameRange}
+		return &response
+	}
+
+	lines := splitCellIntoLines(doc)
+	if position.Line >= len(lines) {
+		return &response
+	}
+	start, end := wordBounds(lines[position.Line], position.Character)
+	if start == end {
+		return &response
+	}
+
+	name := lines[position.Line][start:end]
+	if location, ok := s.findDefinition(uri, name, map[string]bool{}); ok {
+		logger.Printf("Found definition of %s in %s", name, location.URI)
+		response.Result = &location
+	}
+
+	return &response
+}
+
+func (s *State) DocumentLinks(id int, uri string, logger *log.Logger) *lsp.DocumentLinkResponse {
+
+	links := []lsp.DocumentLink{}
+
+	for _, include := range findRunIncludes(s.Documents[uri]) {
+		target, ok := s.resolveRunPath(uri, include.path)
+		if !ok {
+			logger.Printf("Could not resolve %%run %s", include.path)
+			continue
+		}
+
+		links = append(links, lsp.DocumentLink{
+			Range:   include.lspRange(),
+			Target:  target,
+			Tooltip: uriToPath(target),
+		})
+	}
+
+	response := lsp.DocumentLinkResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: links,
+	}
+
+	return &response
+}
+
+func (include runInclude) lspRange() lsp.Range {
+	return lsp.Range{
+		StartPosition: lsp.Position{Line: include.line, Character: include.start},
+		EndPosition:   lsp.Position{Line: include.line, Character: include.end},
+	}
+}
+
+// findRunIncludes returns the %run command of every %run cell in a notebook.
+func findRunIncludes(doc string) []runInclude {
+	var includes []runInclude
+
+	if !isNotebook(doc) {
+		return includes
+	}
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "run" {
+			continue
+		}
+
+		for i, line := range c.lines {
+			content, offset, isMagic := magicContent(line)
+			if !isMagic {
+				continue
+			}
+
+			words := splitWordsWithPosition(content)
+			if len(words) < 2 || !strings.EqualFold(words[0].value, "%run") {
+				continue
+			}
+
+			path := words[1]
+			includes = append(includes, runInclude{
+				path:  strings.Trim(path.value, `"'`),
+				line:  c.startLine + i,
+				start: offset + path.start,
+				end:   offset + path.start + len(path.value),
+			})
+			break
+		}
+	}
+
+	return includes
+}
+
+// resolveRunPath finds the file a %run path refers to. Relative paths are
+// tried against the notebook's folder and then the workspace root. Absolute
+// workspace paths, such as /Repos/user/repo/shared/config, are matched against
+// the workspace root by dropping leading folders until a file is found.
+func (s *State) resolveRunPath(uri, path string) (string, bool) {
+	var candidates []string
+
+	if strings.HasPrefix(path, "/") {
+		if s.WorkspaceRoot != "" {
+			parts := strings.Split(strings.Trim(path, "/"), "/")
+			for i := range parts {
+				candidates = append(candidates, filepath.Join(append([]string{s.WorkspaceRoot}, parts[i:]...)...))
+			}
+		}
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(uriToPath(uri)), path))
+		if s.WorkspaceRoot != "" {
+			candidates = append(candidates, filepath.Join(s.WorkspaceRoot, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		for _, extension := range runNotebookExtensions {
+			info, err := os.Stat(candidate + extension)
+			if err == nil && !info.IsDir() {
+				return pathToURI(candidate + extension), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// documentContent returns the open version of a document, or the indexed
+// one, or reads it from disk when it is neither open nor indexed.
+func (s *State) documentContent(uri string) (string, bool) {
+	if doc, ok := s.Documents[uri]; ok {
+		return doc, true
+	}
+	if notebook, ok := s.index.notebook(uri); ok {
+		return notebook.content, true
+	}
+
+	content, err := os.ReadFile(uriToPath(uri))
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// findDefinition looks for a name in a document and then in the notebooks it
+// includes with %run, the most recent include first.
+func (s *State) findDefinition(uri, name string, visited map[string]bool) (lsp.Location, bool) {
+	if visited[uri] {
+		return lsp.Location{}, false
+	}
+	visited[uri] = true
+
+	doc, ok := s.documentContent(uri)
+	if !ok {
+		return lsp.Location{}, false
+	}
+
+	if r, ok := pythonDefinitions(doc)[name]; ok {
+		return lsp.Location{URI: uri, Range: r}, true
+	}
+
+	includes := findRunIncludes(doc)
+	for i := len(includes) - 1; i >= 0; i-- {
+		target, ok := s.resolveRunPath(uri, includes[i].path)
+		if !ok {
+			continue
+		}
+		if location, ok := s.findDefinition(target, name, visited); ok {
+			return location, true
+		}
+	}
+
+	return lsp.Location{}, false
+}
+
+// pythonDefinitions maps each top level name in a document to where it is
+// first defined.
+func pythonDefinitions(doc string) map[string]lsp.Range {
+	definitions := map[string]lsp.Range{}
+
+	for i, line := range splitCellIntoLines(doc) {
+		match := pythonTopLevelName.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+
+		start, end := match[2], match[3]
+		if start < 0 {
+			start, end = match[4], match[5]
+		}
+
+		name := line[start:end]
+		if _, found := definitions[name]; found {
+			continue
+		}
+		definitions[name] = lsp.Range{
+			StartPosition: lsp.Position{Line: i, Character: start},
+			EndPosition:   lsp.Position{Line: i, Character: end},
+		}
+	}
+
+	return definitions
+}
+
+// lintSource returns the text that is linted for a document. Notebooks start
+// with the notebook globals stub, and the notebook of every %run command is
+// inlined after that command, so that the names it defines are known to ruff
+// and mypy. Each inlined notebook sits in an "if True:" block, which keeps
+// later imports counted as top of file imports. The returned line map gives
+// the document line for each line of the text, or -1 for inlined lines.
+func (s *State) lintSource(uri string) (string, []int) {
+	doc := s.Documents[uri]
+	lines := splitCellIntoLines(doc)
+
+	var lintLines []string
+	var lineMap []int
+
+	if isNotebook(doc) {
+		for _, line := range notebookGlobalsBlock() {
+			lintLines = append(lintLines, line)
+			lineMap = append(lineMap, -1)
+		}
+	}
+
+	includes := map[int]runInclude{}
+	for _, include := range findRunIncludes(doc) {
+		includes[include.line] = include
+	}
+
+	for i, line := range lines {
+		lintLines = append(lintLines, line)
+		lineMap = append(lineMap, i)
+
+		include, ok := includes[i]
+		if !ok {
+			continue
+		}
+		for _, inlined := range s.inlineRunInclude(uri, include, map[string]bool{uri: true}) {
+			lintLines = append(lintLines, inlined)
+			lineMap = append(lineMap, -1)
+		}
+	}
+
+	return strings.Join(lintLines, "\n"), lineMap
+}
+
+// inlineRunInclude returns the lines of the notebook named by a %run command,
+// with its own includes inlined. Notebooks already being inlined further up
+// are skipped so that cycles end.
+func (s *State) inlineRunInclude(uri string, include runInclude, ancestors map[string]bool) []string {
+	target, ok := s.resolveRunPath(uri, include.path)
+	if !ok || ancestors[target] {
+		return nil
+	}
+
+	doc, ok := s.documentContent(target)
+	if !ok {
+		return nil
+	}
+
+	ancestors[target] = true
+	defer delete(ancestors, target)
+
+	nested := map[int]runInclude{}
+	for _, n := range findRunIncludes(doc) {
+		nested[n.line] = n
+	}
+
+	inlined := []string{"if True:"}
+	for i, line := range splitCellIntoLines(doc) {
+		inlined = append(inlined, runBlockIndent+strings.TrimRight(line, "\r"))
+
+		if n, ok := nested[i]; ok {
+			for _, nestedLine := range s.inlineRunInclude(target, n, ancestors) {
+				inlined = append(inlined, runBlockIndent+nestedLine)
+			}
+		}
+	}
+
+	return append(inlined, runBlockIndent+"pass")
+}
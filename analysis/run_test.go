@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefinitionAcrossRun(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "shared"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	config := "# Databricks notebook source\nCATALOG = \"main\"\n\ndef load_table(name):\n    return name\n"
+	if err := os.WriteFile(filepath.Join(root, "shared", "config.py"), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := pathToURI(filepath.Join(root, "jobs", "daily.py"))
+	state := NewState()
+	state.SetWorkspaceRoot(pathToURI(root), nil)
+	state.OpenDocument(uri, "# Databricks notebook source\n# MAGIC %run ../shared/config\n\n# COMMAND ----------\n\n# MAGIC %run /Repos/me/project/shared/config\n\n# COMMAND ----------\n\ndf = load_table(CATALOG)\n")
+	logger := log.New(os.Stderr, "", 0)
+
+	configURI := pathToURI(filepath.Join(root, "shared", "config.py"))
+
+	links := state.DocumentLinks(1, uri, logger).Result
+	if len(links) != 2 || links[0].Target != configURI || links[1].Target != configURI {
+		t.Fatalf("Expected both %%run paths to link to %s, Got: %+v", configURI, links)
+	}
+	if links[0].Range.StartPosition.Character != 13 || links[0].Range.EndPosition.Character != 29 {
+		t.Fatalf("Expected link over the path, Got: %+v", links[0].Range)
+	}
+
+	response := state.Definition(1, uri, lsp.Position{Line: 9, Character: 8}, logger)
+	if response.Result == nil || response.Result.URI != configURI || response.Result.Range.StartPosition.Line != 3 {
+		t.Fatalf("Expected load_table in config, Got: %+v", response.Result)
+	}
+}
+
+func TestLintSourceInlinesRun(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.py", "# Databricks notebook source\n# MAGIC %run ./b\nA = 1\n")
+	write("b.py", "# Databricks notebook source\n# MAGIC %run ./a\nB = 2\n")
+
+	uri := pathToURI(filepath.Join(root, "main.py"))
+	state := NewState()
+	state.OpenDocument(uri, "# Databricks notebook source\n# MAGIC %run ./a\n\nprint(A, B)\n")
+
+	source, lineMap := state.lintSource(uri)
+	globals := strings.Join(notebookGlobalsBlock(), "\n") + "\n"
+	if !strings.HasPrefix(source, globals) {
+		t.Fatalf("Expected the notebook globals first, Got:\n%s", source)
+	}
+	source = strings.TrimPrefix(source, globals)
+	offset := len(notebookGlobalsBlock())
+
+	expected := "# Databricks notebook source\n# MAGIC %run ./a\nif True:\n    # Databricks notebook source\n    # MAGIC %run ./b\n" +
+		"    if True:\n        # Databricks notebook source\n        # MAGIC %run ./a\n        B = 2\n        \n        pass\n" +
+		"    A = 1\n    \n    pass\n\nprint(A, B)\n"
+	if source != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, source)
+	}
+
+	messages := mapLintLines([]errorMessage{
+		{line: offset + 9, char: 9, endLine: offset + 9, endChar: 10, code: "F841"},
+		{line: offset + 16, char: 7, endLine: offset + 16, endChar: 8, code: "F821"},
+	}, lineMap)
+	if len(messages) != 1 || messages[0].line != 4 || messages[0].endLine != 4 {
+		t.Fatalf("Expected only the message on line 4, Got: %+v", messages)
+	}
+}
+
+func TestLintIgnoresRedefinedNotebookGlobals(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\nfrom databricks.sdk.runtime import display\ndef clean(df):\n    pass\ndef clean(df):\n    pass\n")
+	_, lineMap := state.lintSource("file:///nb.py")
+
+	stubLine := 0
+	for i, line := range notebookGlobalsBlock() {
+		if strings.Contains(line, "def display(") {
+			stubLine = i + 1
+		}
+	}
+	offset := len(notebookGlobalsBlock())
+
+	messages := mapLintLines([]errorMessage{
+		{line: offset + 2, char: 36, code: "F811", desc: fmt.Sprintf("Redefinition of unused `display` from line %d", stubLine)},
+		{line: offset + 2, char: 1, code: "no-redef", desc: fmt.Sprintf("Name \"display\" already defined on line %d", stubLine)},
+		{line: offset + 5, char: 5, code: "F811", desc: fmt.Sprintf("Redefinition of unused `clean` from line %d", offset+3)},
+	}, lineMap)
+	if len(messages) != 1 || messages[0].line != 5 {
+		t.Fatalf("Expected only the redefinition of the notebook's own function, Got: %+v", messages)
+	}
+}
@@ -0,0 +1,153 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"strings"
+)
+
+// openCall is a function call that is still open at the cursor.
+type openCall struct {
+	name   string
+	commas int
+}
+
+func (s *State) SignatureHelp(id int, uri string, position lsp.Position, logger *log.Logger) *lsp.SignatureHelpResponse {
+
+	response := lsp.SignatureHelpResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	doc := s.Documents[uri]
+
+	if pythonText, ok := pythonTextBeforePosition(doc, position); ok {
+		if call, ok := activeCall(pythonText, "#"); ok {
+			if help, ok := dbutilsSignatureHelp(call); ok {
+				logger.Printf("Signature help for %s, argument %d", call.name, call.commas)
+				response.Result = help
+			}
+		}
+		return &response
+	}
+
+	sqlText, ok := sqlTextBeforePosition(doc, position)
+	if !ok {
+		return &response
+	}
+
+	call, ok := activeCall(sqlText, "--")
+	if !ok {
+		return &response
+	}
+
+	function, ok := sqlFunctionsByName[strings.ToLower(call.name)]
+	if !ok || len(function.Signatures) == 0 {
+		return &response
+	}
+
+	logger.Printf("Signature help for %s, argument %d", function.Name, call.commas)
+	response.Result = function.signatureHelp(call.commas)
+
+	return &response
+}
+
+// activeCall finds the innermost function call that is open at the end of
+// the text, skipping string literals, quoted identifiers and comments that
+// start with the given marker. The name of the call keeps any dotted prefix.
+func activeCall(text, comment string) (openCall, bool) {
+	var calls []openCall
+
+	for i := 0; i < len(text); i++ {
+		switch char := text[i]; char {
+		case '\'', '"', '`':
+			end := strings.IndexByte(text[i+1:], char)
+			if end < 0 {
+				return openCall{}, false
+			}
+			i += end + 1
+		case comment[0]:
+			if strings.HasPrefix(text[i:], comment) {
+				end := strings.IndexByte(text[i:], '\n')
+				if end < 0 {
+					return openCall{}, false
+				}
+				i += end
+			}
+		case '(':
+			calls = append(calls, openCall{name: lastDottedName(strings.TrimRight(text[:i], " \t"))})
+		case ')':
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+		case ',':
+			if len(calls) > 0 {
+				calls[len(calls)-1].commas++
+			}
+		}
+	}
+
+	if len(calls) == 0 || calls[len(calls)-1].name == "" {
+		return openCall{}, false
+	}
+	return calls[len(calls)-1], true
+}
+
+// lastDottedName returns the name, such as dbutils.fs.ls, at the end of text.
+func lastDottedName(text string) string {
+	start := len(text)
+	for start > 0 && (isWordChar(rune(text[start-1])) || text[start-1] == '.') {
+		start--
+	}
+	return strings.TrimLeft(text[start:], ".")
+}
+
+func (f sqlFunction) signatureHelp(argument int) *lsp.SignatureHelp {
+	help := lsp.SignatureHelp{ActiveSignature: -1}
+
+	for i, sig := range f.Signatures {
+		information := lsp.SignatureInformation{
+			Label: sig.label(f.Name),
+			Documentation: &lsp.MarkupContent{
+				Kind:  lsp.MarkupKindMarkdown,
+				Value: f.Description,
+			},
+			Parameters: []lsp.ParameterInformation{},
+		}
+		if sig.Syntax == "" {
+			for _, p := range sig.Parameters {
+				information.Parameters = append(information.Parameters, lsp.ParameterInformation{Label: p.label()})
+			}
+		}
+		help.Signatures = append(help.Signatures, information)
+
+		if help.ActiveSignature == -1 && sig.accepts(argument) {
+			help.ActiveSignature = i
+		}
+	}
+
+	if help.ActiveSignature == -1 {
+		help.ActiveSignature = len(f.Signatures) - 1
+	}
+	help.ActiveParameter = f.Signatures[help.ActiveSignature].parameterIndex(argument)
+
+	return &help
+}
+
+// accepts reports whether the overload takes an argument at the given index.
+func (sig sqlSignature) accepts(argument int) bool {
+	count := len(sig.Parameters)
+	return argument < count || (count > 0 && sig.Parameters[count-1].Variadic)
+}
+
+// parameterIndex maps an argument index onto the parameter it fills, so that
+// every argument past a variadic parameter highlights that parameter.
+func (sig sqlSignature) parameterIndex(argument int) int {
+	count := len(sig.Parameters)
+	if argument >= count && count > 0 && sig.Parameters[count-1].Variadic {
+		return count - 1
+	}
+	return argument
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+func TestSignatureHelpActiveParameter(t *testing.T) {
+	tests := []struct {
+		line      string
+		label     string
+		parameter int
+	}{
+		{"# MAGIC SELECT date_add(", "date_add(startDate DATE, numDays INT) -> DATE", 0},
+		{"# MAGIC SELECT date_add(order_date, ", "date_add(startDate DATE, numDays INT) -> DATE", 1},
+		{"# MAGIC SELECT date_add(concat(a, b), ", "date_add(startDate DATE, numDays INT) -> DATE", 1},
+		{"# MAGIC SELECT concat(a, ',', b, ", "concat(expr ANY...) -> STRING", 0},
+		{"# MAGIC SELECT round(price, ", "round(expr NUMERIC, [targetScale INT]) -> NUMERIC", 1},
+	}
+
+	for _, test := range tests {
+		state := NewState()
+		state.OpenDocument("file:///nb.py", "# Databricks notebook source\n# COMMAND ----------\n# MAGIC %sql\n"+test.line)
+
+		response := state.SignatureHelp(1, "file:///nb.py", lsp.Position{Line: 3, Character: len(test.line)}, log.New(os.Stderr, "", 0))
+		if response.Result == nil {
+			t.Fatalf("Expected signature help for %q", test.line)
+		}
+
+		help := response.Result
+		if help.Signatures[help.ActiveSignature].Label != test.label || help.ActiveParameter != test.parameter {
+			t.Fatalf("Expected %s at %d for %q, Got: %s at %d", test.label, test.parameter, test.line,
+				help.Signatures[help.ActiveSignature].Label, help.ActiveParameter)
+		}
+	}
+}
+
+func TestSignatureHelpOutsideCall(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", "# Databricks notebook source\n# COMMAND ----------\n# MAGIC %sql\n# MAGIC SELECT date_add(a, 1) FROM t")
+
+	response := state.SignatureHelp(1, "file:///nb.py", lsp.Position{Line: 3, Character: 35}, log.New(os.Stderr, "", 0))
+	if response.Result != nil {
+		t.Fatalf("Expected no signature help, Got: %+v", response.Result)
+	}
+}
@@ -0,0 +1,194 @@
+package analysis
+
+import (
+	"myfirstlsp/lsp"
+	"strings"
+)
+
+const sparkSqlCall = "spark.sql("
+
+var pythonStringQuotes = []string{`"""`, `'''`, `"`, `'`}
+
+// sqlTextBeforePosition returns the SQL written before the cursor when the
+// cursor is inside a %sql cell or a spark.sql string.
+func sqlTextBeforePosition(doc string, position lsp.Position) (string, bool) {
+	lines := splitCellIntoLines(doc)
+	if position.Line >= len(lines) {
+		return "", false
+	}
+
+	for _, c := range splitIntoSQLCells(doc) {
+		if position.Line < c.startLine || position.Line >= c.startLine+len(c.lines) {
+			continue
+		}
+
+		var sqlLines []string
+		for i, line := range c.lines[:position.Line-c.startLine+1] {
+			content, offset, isMagic := magicContent(line)
+			if c.startLine+i == position.Line {
+				if !isMagic || position.Character < offset {
+					return "", false
+				}
+				content = content[:min(position.Character-offset, len(content))]
+			} else if !isMagic {
+				continue
+			}
+			sqlLines = append(sqlLines, content)
+		}
+
+		return stripMagicCommand(strings.Join(sqlLines, "\n")), true
+	}
+
+	prefix := strings.Join(lines[:position.Line], "\n")
+	if position.Line > 0 {
+		prefix += "\n"
+	}
+	prefix += lines[position.Line][:min(position.Character, len(lines[position.Line]))]
+
+	_, body, ok := openSparkSqlString(prefix)
+	return body, ok
+}
+
+// sqlTextAfterPosition returns the SQL written after the cursor, up to the end
+// of the %sql cell or spark.sql string it is in.
+func sqlTextAfterPosition(doc string, position lsp.Position) string {
+	lines := splitCellIntoLines(doc)
+	if position.Line >= len(lines) {
+		return ""
+	}
+
+	for _, c := range splitIntoSQLCells(doc) {
+		if position.Line < c.startLine || position.Line >= c.startLine+len(c.lines) {
+			continue
+		}
+
+		var sqlLines []string
+		for i, line := range c.lines[position.Line-c.startLine:] {
+			content, offset, isMagic := magicContent(line)
+			if !isMagic {
+				continue
+			}
+			if i == 0 {
+				content = content[min(max(position.Character-offset, 0), len(content)):]
+			}
+			sqlLines = append(sqlLines, content)
+		}
+
+		return strings.Join(sqlLines, "\n")
+	}
+
+	prefix := strings.Join(lines[:position.Line], "\n")
+	if position.Line > 0 {
+		prefix += "\n"
+	}
+	prefix += lines[position.Line][:min(position.Character, len(lines[position.Line]))]
+
+	quote, _, ok := openSparkSqlString(prefix)
+	if !ok {
+		return ""
+	}
+	line := lines[position.Line]
+	rest := strings.Join(append([]string{line[min(position.Character, len(line)):]}, lines[position.Line+1:]...), "\n")
+	if end := strings.Index(rest, quote); end >= 0 {
+		rest = rest[:end]
+	}
+	return rest
+}
+
+func stripMagicCommand(sql string) string {
+	trimmed := strings.TrimLeft(sql, " \t\n")
+	if strings.HasPrefix(trimmed, "%") {
+		end := strings.IndexAny(trimmed, " \t\n")
+		if end < 0 {
+			return ""
+		}
+		return trimmed[end:]
+	}
+	return sql
+}
+
+// openSparkSqlString returns the opening quote and body of the spark.sql
+// string that is still open at the end of text.
+func openSparkSqlString(text string) (string, string, bool) {
+	idx := strings.LastIndex(text, sparkSqlCall)
+	if idx < 0 {
+		return "", "", false
+	}
+
+	quote, body, found := cutPythonString(text[idx+len(sparkSqlCall):])
+	if !found || strings.Contains(body, quote) {
+		return "", "", false
+	}
+	if len(quote) == 1 && strings.Contains(body, "\n") {
+		return "", "", false
+	}
+	return quote, body, true
+}
+
+// cutPythonString skips an optional string prefix and returns the opening
+// quote and the text following it.
+func cutPythonString(text string) (string, string, bool) {
+	text = strings.TrimLeft(text, " \t\r\n")
+	text = strings.TrimLeft(text, "fFrR")
+
+	for _, quote := range pythonStringQuotes {
+		if strings.HasPrefix(text, quote) {
+			return quote, text[len(quote):], true
+		}
+	}
+	return "", "", false
+}
+
+// sqlSpan is a piece of SQL and the offset it starts at in the text it was
+// found in.
+type sqlSpan struct {
+	start int
+	sql   string
+}
+
+// sparkSqlStrings returns the body of every spark.sql string in a document.
+func sparkSqlStrings(doc string) []string {
+	var bodies []string
+	for _, span := range sparkSqlSpans(doc) {
+		bodies = append(bodies, span.sql)
+	}
+	return bodies
+}
+
+// sparkSqlSpans returns the body of every spark.sql string in a text, with
+// where each body starts.
+func sparkSqlSpans(text string) []sqlSpan {
+	var spans []sqlSpan
+
+	rest := text
+	for {
+		idx := strings.Index(rest, sparkSqlCall)
+		if idx < 0 {
+			return spans
+		}
+		rest = rest[idx+len(sparkSqlCall):]
+
+		quote, body, found := cutPythonString(rest)
+		if !found {
+			continue
+		}
+
+		start := len(text) - len(body)
+		end := strings.Index(body, quote)
+		if end < 0 {
+			return append(spans, sqlSpan{start: start, sql: body})
+		}
+		spans = append(spans, sqlSpan{start: start, sql: body[:end]})
+	}
+}
+
+// sqlSources returns the SQL text of every %sql cell and spark.sql string.
+func sqlSources(doc string) []string {
+	var sources []string
+
+	for _, c := range splitIntoSQLCells(doc) {
+		sources = append(sources, stripMagicCommand(strings.Join(c.source(), "\n")))
+	}
+
+	return append(sources, sparkSqlStrings(doc)...)
+}
@@ -0,0 +1,169 @@
+package analysis
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed data/sql_functions.json
+var sqlFunctionData []byte
+
+//go:embed data/sql_keywords.json
+var sqlKeywordData []byte
+
+type sqlFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Example     string         `json:"example"`
+	Signatures  []sqlSignature `json:"signatures"`
+}
+
+// sqlSignature is one overload of a function. Operators and functions with
+// special syntax, such as cast, only have a Syntax string.
+type sqlSignature struct {
+	Syntax     string         `json:"syntax"`
+	Parameters []sqlParameter `json:"parameters"`
+	Returns    string         `json:"returns"`
+}
+
+type sqlParameter struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+	Variadic bool   `json:"variadic"`
+}
+
+type sqlKeyword struct {
+	Name        string `json:"name"`
+	Syntax      string `json:"syntax"`
+	Description string `json:"description"`
+}
+
+var (
+	sqlFunctions       = loadSqlData[sqlFunction](sqlFunctionData)
+	sqlKeywords        = loadSqlData[sqlKeyword](sqlKeywordData)
+	sqlFunctionsByName = indexSqlFunctions(sqlFunctions)
+	sqlKeywordsByName  = indexSqlKeywords(sqlKeywords)
+)
+
+func loadSqlData[T any](data []byte) []T {
+	var entries []T
+	if err := json.Unmarshal(data, &entries); err != nil {
+		panic(fmt.Sprintf("invalid embedded SQL data: %s", err))
+	}
+	return entries
+}
+
+func indexSqlFunctions(functions []sqlFunction) map[string]sqlFunction {
+	index := make(map[string]sqlFunction, len(functions))
+	for _, f := range functions {
+		index[strings.ToLower(f.Name)] = f
+	}
+	return index
+}
+
+func indexSqlKeywords(keywords []sqlKeyword) map[string]sqlKeyword {
+	index := make(map[string]sqlKeyword, len(keywords))
+	for _, k := range keywords {
+		index[strings.ToLower(k.Name)] = k
+	}
+	return index
+}
+
+func (p sqlParameter) label() string {
+	label := p.Name
+	if p.Type != "" {
+		label += " " + p.Type
+	}
+	if p.Variadic {
+		label += "..."
+	}
+	if p.Optional {
+		label = "[" + label + "]"
+	}
+	return label
+}
+
+func (sig sqlSignature) label(name string) string {
+	call := sig.Syntax
+	if call == "" {
+		var params []string
+		for _, p := range sig.Parameters {
+			params = append(params, p.label())
+		}
+		call = fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+	}
+
+	if sig.Returns != "" {
+		call += " -> " + sig.Returns
+	}
+	return call
+}
+
+func (f sqlFunction) documentation() string {
+	var signatures []string
+	for _, sig := range f.Signatures {
+		signatures = append(signatures, sig.label(f.Name))
+	}
+
+	return fmt.Sprintf("```sql\n%s\n```\n\n%s\n\n**Example:**\n```sql\n%s\n```", strings.Join(signatures, "\n"), f.Description, f.Example)
+}
+
+func (k sqlKeyword) documentation() string {
+	return fmt.Sprintf("```sql\n%s\n```\n\n%s", k.Syntax, k.Description)
+}
+
+// sqlWordDocumentation looks up the documentation for the SQL word under the
+// cursor. Keywords are matched together with the word before or after them so
+// that statements like CREATE TABLE find their own entry.
+func sqlWordDocumentation(line string, character int) (string, bool) {
+	start, end := wordBounds(line, character)
+	if start == end {
+		return "", false
+	}
+	word := strings.ToLower(line[start:end])
+
+	if function, found := sqlFunctionsByName[word]; found && strings.HasPrefix(strings.TrimLeft(line[end:], " "), "(") {
+		return function.documentation(), true
+	}
+
+	previous := strings.ToLower(lastWord(line[:start]))
+	next := strings.ToLower(firstWord(line[end:]))
+	for _, phrase := range []string{previous + " " + word, word + " " + next, word} {
+		if keyword, found := sqlKeywordsByName[phrase]; found {
+			return keyword.documentation(), true
+		}
+	}
+
+	if function, found := sqlFunctionsByName[word]; found {
+		return function.documentation(), true
+	}
+	return "", false
+}
+
+func wordBounds(line string, character int) (int, int) {
+	start := min(character, len(line))
+	for start > 0 && isWordChar(rune(line[start-1])) {
+		start--
+	}
+
+	end := start
+	for end < len(line) && isWordChar(rune(line[end])) {
+		end++
+	}
+	return start, end
+}
+
+func firstWord(text string) string {
+	text = strings.TrimLeft(text, " ")
+	_, end := wordBounds(text, 0)
+	return text[:end]
+}
+
+func lastWord(text string) string {
+	text = strings.TrimRight(text, " ")
+	start, _ := wordBounds(text, len(text))
+	return text[start:]
+}
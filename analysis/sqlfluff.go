@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const sqlfluffDialect = "sparksql"
+
+// sqlfluffCell is the SQL of a %sql cell as written out for sqlfluff, with
+// the document line and column that each of its lines starts at.
+type sqlfluffCell struct {
+	path    string
+	sql     string
+	lines   []int
+	columns []int
+}
+
+type sqlfluffFile struct {
+	Filepath   string              `json:"filepath"`
+	Violations []sqlfluffViolation `json:"violations"`
+}
+
+type sqlfluffViolation struct {
+	StartLine   int    `json:"start_line_no"`
+	StartPos    int    `json:"start_line_pos"`
+	EndLine     int    `json:"end_line_no"`
+	EndPos      int    `json:"end_line_pos"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Warning     bool   `json:"warning"`
+}
+
+// sqlfluffMessages lints each %sql cell of a document as its own file with
+// `sqlfluff lint`.
+func (s *State) sqlfluffMessages(uri string, logger *log.Logger) ([]errorMessage, error) {
+	cells := sqlfluffCells(uri, s.Documents[uri])
+	if len(cells) == 0 {
+		return nil, nil
+	}
+
+	execPath, err := exec.LookPath("sqlfluff")
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"lint", "--format", "json", "--dialect", sqlfluffDialect}
+	for _, c := range cells {
+		if err := os.WriteFile(c.path, []byte(c.sql), 0644); err != nil {
+			return nil, err
+		}
+		defer os.Remove(c.path)
+		args = append(args, c.path)
+	}
+
+	command := exec.Command(execPath, args...)
+	var out, stderr bytes.Buffer
+	command.Stdout = &out
+	command.Stderr = &stderr
+
+	// sqlfluff exits with 1 when it finds violations.
+	if err := command.Run(); err != nil && out.Len() == 0 {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	logger.Printf("sqlfluff linted %d cells", len(cells))
+
+	return parseSqlfluffResults(out.String(), cells)
+}
+
+// sqlfluffCells writes out the SQL of each %sql cell, from the line after the
+// magic command to the last line of SQL, so that sqlfluff's layout rules see
+// the SQL as a file of its own.
+func sqlfluffCells(uri, doc string) []sqlfluffCell {
+	var cells []sqlfluffCell
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "sql" {
+			continue
+		}
+
+		cell := sqlfluffCell{
+			path: fmt.Sprintf("%s.temp_%s_%d.sql", GetTempPath(), GetTempFileName(uri), c.startLine),
+		}
+		var lines []string
+		commandFound := false
+
+		for i, line := range c.lines {
+			content, offset, isMagic := magicContent(line)
+			if !isMagic {
+				content = ""
+			}
+
+			if !commandFound {
+				trimmed := strings.TrimLeft(content, " \t")
+				if !strings.HasPrefix(trimmed, "%") {
+					continue
+				}
+				commandFound = true
+
+				rest := strings.TrimPrefix(trimmed, strings.Fields(trimmed)[0])
+				sql := strings.TrimLeft(rest, " \t")
+				if sql == "" {
+					continue
+				}
+				offset += len(content) - len(sql)
+				content = sql
+			}
+
+			lines = append(lines, content)
+			cell.lines = append(cell.lines, c.startLine+i)
+			cell.columns = append(cell.columns, offset)
+		}
+
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		cell.sql = strings.Join(lines, "\n") + "\n"
+		cell.lines = cell.lines[:len(lines)]
+		cell.columns = cell.columns[:len(lines)]
+		cells = append(cells, cell)
+	}
+
+	return cells
+}
+
+// parseSqlfluffResults reads the output of `sqlfluff lint --format json` and
+// moves each violation back to the cell it came from. Parse errors are left
+// to the SQL syntax checks.
+func parseSqlfluffResults(output string, cells []sqlfluffCell) ([]errorMessage, error) {
+	var files []sqlfluffFile
+	if err := json.Unmarshal([]byte(output), &files); err != nil {
+		return nil, err
+	}
+
+	byPath := map[string]sqlfluffCell{}
+	for _, c := range cells {
+		byPath[filepath.Clean(c.path)] = c
+	}
+
+	var messages []errorMessage
+	for _, file := range files {
+		c, found := byPath[filepath.Clean(file.Filepath)]
+		if !found {
+			continue
+		}
+
+		for _, v := range file.Violations {
+			if v.Code == "PRS" {
+				continue
+			}
+
+			severity := 2
+			if v.Warning {
+				severity = 3
+			}
+
+			msg := errorMessage{
+				code:     v.Code,
+				desc:     v.Description,
+				source:   "sqlfluff",
+				severity: severity,
+			}
+			msg.line, msg.char = c.documentPosition(v.StartLine, v.StartPos)
+			if v.EndLine > 0 {
+				msg.endLine, msg.endChar = c.documentPosition(v.EndLine, v.EndPos)
+			}
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages, nil
+}
+
+// documentPosition turns a 1-based position in the cell's SQL into a 1-based
+// position in the document.
+func (c sqlfluffCell) documentPosition(line, pos int) (int, int) {
+	index := min(max(line-1, 0), len(c.lines)-1)
+	return c.lines[index] + 1, c.columns[index] + max(pos, 1)
+}
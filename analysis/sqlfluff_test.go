@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSqlfluffResults(t *testing.T) {
+	doc := `# Databricks notebook source
+print("hello")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC select a,b
+# MAGIC from t
+
+# COMMAND ----------
+
+# MAGIC %sql SELECT 1
+`
+	cells := sqlfluffCells("file:///test.py", doc)
+	if len(cells) != 2 {
+		t.Fatalf("Expected 2 SQL cells, Got: %+v", cells)
+	}
+	if cells[0].sql != "select a,b\nfrom t\n" || cells[1].sql != "SELECT 1\n" {
+		t.Fatalf("Expected the SQL without magic commands, Got: %q and %q", cells[0].sql, cells[1].sql)
+	}
+
+	output := fmt.Sprintf(`[
+		{"filepath": %q, "violations": [
+			{"start_line_no": 1, "start_line_pos": 9, "end_line_no": 1, "end_line_pos": 10, "code": "LT01", "description": "Expected single whitespace.", "warning": false},
+			{"start_line_no": 2, "start_line_pos": 1, "code": "CP01", "description": "Keywords must be consistently upper case.", "warning": true}
+		]},
+		{"filepath": %q, "violations": [
+			{"start_line_no": 1, "start_line_pos": 8, "code": "PRS", "description": "Line 1, Position 8: Found unparsable section", "warning": false}
+		]}
+	]`, cells[0].path, cells[1].path)
+
+	messages, err := parseSqlfluffResults(output, cells)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages without the parse error, Got: %+v", messages)
+	}
+
+	comma := messages[0]
+	if comma.line != 7 || comma.char != 17 || comma.endLine != 7 || comma.endChar != 18 || comma.code != "LT01" || comma.severity != 2 || comma.source != "sqlfluff" {
+		t.Fatalf("Expected LT01 at the comma on line 7, Got: %+v", comma)
+	}
+
+	keyword := messages[1]
+	if keyword.line != 8 || keyword.char != 9 || keyword.endLine != 0 || keyword.severity != 3 {
+		t.Fatalf("Expected a CP01 warning at `from` on line 8, Got: %+v", keyword)
+	}
+}
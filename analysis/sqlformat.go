@@ -0,0 +1,629 @@
+package analysis
+
+import (
+	"myfirstlsp/lsp"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const defaultSqlIndentWidth = 4
+
+// sparkSqlTripleQuote matches the start of a spark.sql call on a triple quoted
+// string. F-strings are left alone.
+var sparkSqlTripleQuote = regexp.MustCompile(`spark\.sql\(\s*[rR]?("""|''')`)
+
+// sqlFormatWords are cased as keywords on top of the single word statements
+// in the keyword catalogue.
+var sqlFormatWords = []string{
+	"all", "and", "anti", "any", "as", "asc", "between", "by", "case", "cluster",
+	"cross", "current", "desc", "distinct", "distribute", "else", "end", "escape",
+	"except", "exists", "false", "first", "following", "for", "full", "group",
+	"having", "if", "ilike", "in", "inner", "intersect", "interval", "is", "join",
+	"last", "lateral", "left", "like", "limit", "matched", "minus", "natural",
+	"not", "null", "nulls", "offset", "on", "or", "order", "outer", "over",
+	"partition", "pivot", "preceding", "qualify", "range", "replace", "right",
+	"rlike", "row", "rows", "semi", "some", "sort", "source", "tablesample",
+	"target", "temp", "temporary", "then", "true", "unbounded", "union",
+	"unpivot", "using", "when", "where", "window",
+}
+
+// sqlOperatorWords are keywords that take parentheses without being called,
+// as in "IN (1, 2)".
+var sqlOperatorWords = map[string]bool{
+	"all": true, "and": true, "any": true, "between": true, "case": true,
+	"exists": true, "ilike": true, "in": true, "is": true, "like": true,
+	"not": true, "or": true, "rlike": true, "some": true,
+}
+
+var sqlFormatKeywords = buildSqlFormatKeywords()
+
+// sqlClauses start a new line of a query. Each is a run of words, with
+// alternatives for the first word.
+var sqlClauses = [][]string{
+	{"select"}, {"from"}, {"where"}, {"having"}, {"qualify"}, {"window"},
+	{"limit"}, {"offset"}, {"with"}, {"values"}, {"union"}, {"intersect"},
+	{"except"}, {"minus"}, {"join"}, {"when"},
+	{"group|order|cluster|distribute|sort|partition", "by"},
+	{"inner|cross|semi|anti", "join"},
+	{"left|right|full|natural", "join"},
+	{"left|right|full", "outer|semi|anti", "join"},
+	{"insert", "into|overwrite"},
+}
+
+// sqlListClauses put each item of their comma separated list on a line.
+var sqlListClauses = map[string]bool{
+	"select": true, "group by": true, "order by": true, "cluster by": true,
+	"distribute by": true, "sort by": true, "partition by": true, "values": true,
+}
+
+// sqlConditionClauses put each AND and OR of their condition on a line.
+var sqlConditionClauses = map[string]bool{
+	"where": true, "having": true, "qualify": true, "on": true,
+}
+
+func buildSqlFormatKeywords() map[string]bool {
+	keywords := map[string]bool{}
+	for _, keyword := range sqlKeywords {
+		if !strings.Contains(keyword.Name, " ") {
+			keywords[strings.ToLower(keyword.Name)] = true
+		}
+	}
+	for _, word := range sqlFormatWords {
+		keywords[word] = true
+	}
+	return keywords
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenWord sqlTokenKind = iota
+	sqlTokenLiteral
+	sqlTokenLineComment
+	sqlTokenBlockComment
+	sqlTokenOpen
+	sqlTokenClose
+	sqlTokenComma
+	sqlTokenSemicolon
+	sqlTokenDot
+	sqlTokenOperator
+	sqlTokenEnd
+)
+
+type sqlToken struct {
+	kind          sqlTokenKind
+	text          string
+	offset        int
+	spaceBefore   bool
+	newlineBefore bool
+}
+
+func (t sqlToken) isWord(words ...string) bool {
+	if t.kind != sqlTokenWord {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t sqlToken) isComment() bool {
+	return t.kind == sqlTokenLineComment || t.kind == sqlTokenBlockComment
+}
+
+var sqlOperators = []string{"<=>", "<=", ">=", "<>", "!=", "==", "||", "::", "->", "=>", "<<", ">>", "&&"}
+
+// tokenizeSql splits SQL into tokens, keeping strings, quoted names, comments
+// and placeholders such as ${name} and {name} whole. Unterminated strings and
+// comments are syntax errors.
+func tokenizeSql(sql string) ([]sqlToken, *sqlSyntaxError) {
+	var tokens []sqlToken
+	space, newline := false, false
+
+	for i := 0; i < len(sql); {
+		char := sql[i]
+		rest := sql[i:]
+		start := i
+
+		switch {
+		case char == '\n':
+			space, newline = true, true
+			i++
+			continue
+		case char == ' ' || char == '\t' || char == '\r':
+			space = true
+			i++
+			continue
+		}
+
+		kind := sqlTokenOperator
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			kind = sqlTokenLineComment
+			i += len(strings.SplitN(rest, "\n", 2)[0])
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return nil, unterminatedSql(sql, start, "comment")
+			}
+			kind = sqlTokenBlockComment
+			i += end + 4
+		case char == '\'' || char == '"' || char == '`':
+			end, ok := quotedEnd(sql, i)
+			if !ok {
+				return nil, unterminatedSql(sql, start, "string")
+			}
+			kind = sqlTokenLiteral
+			i = end
+		case char == '{' || (char == '$' && strings.HasPrefix(rest, "${")):
+			end, ok := bracedEnd(sql, strings.IndexByte(rest, '{')+i)
+			if !ok {
+				return nil, unterminatedSql(sql, start, "placeholder")
+			}
+			kind = sqlTokenLiteral
+			i = end
+		case char >= '0' && char <= '9' || (char == '.' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9'):
+			kind = sqlTokenLiteral
+			for i++; i < len(sql); i++ {
+				c := sql[i]
+				if (c == '+' || c == '-') && (sql[i-1] == 'e' || sql[i-1] == 'E') {
+					continue
+				}
+				if c != '.' && !isSqlWordByte(c) {
+					break
+				}
+			}
+		case isSqlWordByte(char):
+			kind = sqlTokenWord
+			for i++; i < len(sql) && isSqlWordByte(sql[i]); i++ {
+			}
+			if i-start == 1 && strings.ContainsRune("rRxX", rune(char)) && i < len(sql) && (sql[i] == '\'' || sql[i] == '"') {
+				end, ok := quotedEnd(sql, i)
+				if !ok {
+					return nil, unterminatedSql(sql, start, "string")
+				}
+				kind = sqlTokenLiteral
+				i = end
+			}
+		case char == '(' || char == '[':
+			kind = sqlTokenOpen
+			i++
+		case char == ')' || char == ']':
+			kind = sqlTokenClose
+			i++
+		case char == ',':
+			kind = sqlTokenComma
+			i++
+		case char == ';':
+			kind = sqlTokenSemicolon
+			i++
+		case char == '.':
+			kind = sqlTokenDot
+			i++
+		default:
+			i++
+			for _, operator := range sqlOperators {
+				if strings.HasPrefix(rest, operator) {
+					i = start + len(operator)
+					break
+				}
+			}
+		}
+
+		tokens = append(tokens, sqlToken{kind: kind, text: sql[start:i], offset: start, spaceBefore: space, newlineBefore: newline})
+		space, newline = false, false
+	}
+
+	return tokens, nil
+}
+
+func isSqlWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// quotedEnd returns the offset after the string or quoted name starting at
+// start. Quotes are escaped by a backslash or by doubling them.
+func quotedEnd(sql string, start int) (int, bool) {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && quote != '`':
+			i++
+		case sql[i] == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		case sql[i] == quote:
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func bracedEnd(sql string, start int) (int, bool) {
+	depth := 0
+	for i := start; i < len(sql); i++ {
+		switch sql[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// sqlFrame is a query, or a pair of parentheses within one. Clauses only
+// break lines in a query frame.
+type sqlFrame struct {
+	query  bool
+	level  int
+	clause string
+}
+
+type sqlFormatter struct {
+	upper  bool
+	indent string
+
+	lines     []string
+	line      []string
+	lineLevel int
+	pending   *sqlBreak
+
+	frames      []sqlFrame
+	caseDepth   int
+	betweenOpen bool
+	prev        *sqlToken
+	unary       bool
+}
+
+type sqlBreak struct {
+	level int
+	blank bool
+}
+
+// formatSql formats Databricks SQL: keywords are cased, each clause starts a
+// line, lists and conditions put an item on each line and subqueries and CTEs
+// are indented. Only whitespace and the case of keywords change. It reports
+// false when the SQL cannot be tokenized.
+func formatSql(sql string, options lsp.SQLFormatOptions, tabSize int) ([]string, bool) {
+	tokens, err := tokenizeSql(sql)
+	if err != nil {
+		return nil, false
+	}
+
+	width := options.IndentWidth
+	if width <= 0 {
+		width = tabSize
+	}
+	if width <= 0 {
+		width = defaultSqlIndentWidth
+	}
+
+	f := sqlFormatter{
+		upper:  !strings.EqualFold(options.KeywordCase, "lower"),
+		indent: strings.Repeat(" ", width),
+		frames: []sqlFrame{{query: true}},
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		i += f.format(tokens, i)
+	}
+	f.flush()
+
+	for len(f.lines) > 0 && f.lines[len(f.lines)-1] == "" {
+		f.lines = f.lines[:len(f.lines)-1]
+	}
+	return f.lines, true
+}
+
+// format writes the token at i and returns how many more tokens it used.
+func (f *sqlFormatter) format(tokens []sqlToken, i int) int {
+	token := tokens[i]
+	frame := &f.frames[len(f.frames)-1]
+	inQuery := frame.query && f.caseDepth == 0
+
+	if f.pending != nil {
+		if token.isComment() && !token.newlineBefore {
+			f.write(token, token.text)
+			return 0
+		}
+		f.newline(f.pending.level, f.pending.blank)
+	}
+	if token.isComment() && token.newlineBefore {
+		f.newline(f.lineLevel, false)
+	}
+
+	switch token.kind {
+	case sqlTokenLineComment:
+		f.write(token, token.text)
+		f.breakAfter(f.lineLevel, false)
+		return 0
+
+	case sqlTokenOpen:
+		subquery := token.text == "(" && nextSignificant(tokens, i).isWord("select", "with")
+		f.write(token, token.text)
+		if subquery {
+			f.frames = append(f.frames, sqlFrame{query: true, level: f.lineLevel + 1})
+			f.breakAfter(f.lineLevel+1, false)
+		} else {
+			f.frames = append(f.frames, sqlFrame{level: frame.level, clause: frame.clause})
+		}
+		return 0
+
+	case sqlTokenClose:
+		if len(f.frames) > 1 {
+			if frame.query {
+				f.newline(frame.level-1, false)
+			}
+			f.frames = f.frames[:len(f.frames)-1]
+		}
+		f.write(token, token.text)
+		return 0
+
+	case sqlTokenComma:
+		f.write(token, token.text)
+		if inQuery && sqlListClauses[frame.clause] {
+			f.breakAfter(frame.level+1, false)
+		} else if inQuery && frame.clause == "with" {
+			f.breakAfter(frame.level, false)
+		}
+		return 0
+
+	case sqlTokenSemicolon:
+		f.write(token, token.text)
+		f.frames = []sqlFrame{{query: true}}
+		f.caseDepth = 0
+		f.betweenOpen = false
+		f.breakAfter(0, true)
+		return 0
+
+	case sqlTokenWord:
+		word := strings.ToLower(token.text)
+
+		if length, clause := sqlClauseAt(tokens, i); inQuery && length > 0 && !f.prevIsDot() {
+			if !(clause == "from" && f.prev != nil && f.prev.isWord("delete")) {
+				f.newline(frame.level, false)
+			}
+			frame.clause = clause
+			for j := i; j < i+length; j++ {
+				f.write(tokens[j], f.caseWord(tokens, j))
+			}
+			return length - 1
+		}
+
+		switch {
+		case f.prevIsDot():
+		case word == "on" && inQuery:
+			frame.clause = "on"
+		case word == "and" && f.betweenOpen:
+			f.betweenOpen = false
+		case (word == "and" || word == "or") && inQuery && sqlConditionClauses[frame.clause]:
+			f.newline(frame.level+1, false)
+		case word == "between":
+			f.betweenOpen = true
+		case word == "case":
+			f.caseDepth++
+		case word == "end" && f.caseDepth > 0:
+			f.caseDepth--
+		}
+		f.write(token, f.caseWord(tokens, i))
+		return 0
+	}
+
+	f.write(token, token.text)
+	return 0
+}
+
+// sqlClauseAt returns the length of the clause starting at i, and the clause
+// in lower case.
+func sqlClauseAt(tokens []sqlToken, i int) (int, string) {
+	for _, clause := range sqlClauses {
+		if i+len(clause) > len(tokens) {
+			continue
+		}
+		var words []string
+		for j, alternatives := range clause {
+			if !tokens[i+j].isWord(strings.Split(alternatives, "|")...) {
+				words = nil
+				break
+			}
+			words = append(words, strings.ToLower(tokens[i+j].text))
+		}
+		// A clause word that is called, like left(name, 2), is a function.
+		if words != nil && !(i+len(clause) < len(tokens) && tokens[i+len(clause)].text == "(" && len(clause) == 1 && isSqlFunction(words[0])) {
+			return len(clause), strings.Join(words, " ")
+		}
+	}
+	return 0, ""
+}
+
+func nextSignificant(tokens []sqlToken, i int) sqlToken {
+	for j := i + 1; j < len(tokens); j++ {
+		if !tokens[j].isComment() {
+			return tokens[j]
+		}
+	}
+	return sqlToken{}
+}
+
+// caseWord applies the keyword case to keywords and to called functions.
+// Names after a dot are left as written.
+func (f *sqlFormatter) caseWord(tokens []sqlToken, i int) string {
+	word := tokens[i].text
+	lower := strings.ToLower(word)
+
+	called := i+1 < len(tokens) && tokens[i+1].text == "("
+	if f.prevIsDot() || !(sqlFormatKeywords[lower] || (called && isSqlFunction(lower))) {
+		return word
+	}
+	if f.upper {
+		return strings.ToUpper(word)
+	}
+	return lower
+}
+
+func (f *sqlFormatter) prevIsDot() bool {
+	return f.prev != nil && f.prev.kind == sqlTokenDot
+}
+
+// write adds a token to the current line, with a space before it unless the
+// tokens around it read better without one.
+func (f *sqlFormatter) write(token sqlToken, text string) {
+	if len(f.line) > 0 && f.spaceBefore(token) {
+		f.line = append(f.line, " ")
+	}
+	f.line = append(f.line, text)
+
+	prev := f.prev
+	f.unary = (token.text == "-" || token.text == "+") && (prev == nil ||
+		prev.kind == sqlTokenOpen || prev.kind == sqlTokenComma || prev.kind == sqlTokenOperator ||
+		(prev.kind == sqlTokenWord && sqlFormatKeywords[strings.ToLower(prev.text)]))
+	f.prev = &token
+}
+
+func (f *sqlFormatter) spaceBefore(token sqlToken) bool {
+	prev := f.prev
+	if prev == nil || f.unary {
+		return false
+	}
+
+	switch {
+	case token.kind == sqlTokenComma || token.kind == sqlTokenSemicolon || token.kind == sqlTokenDot || token.kind == sqlTokenClose:
+		return false
+	case prev.kind == sqlTokenDot || prev.kind == sqlTokenOpen || prev.text == "::" || token.text == "::":
+		return false
+	case prev.text == ":":
+		return false
+	case token.text == ":":
+		return prev.kind != sqlTokenWord && prev.kind != sqlTokenLiteral && prev.kind != sqlTokenClose
+	case token.text == "[":
+		return prev.kind != sqlTokenWord && prev.kind != sqlTokenLiteral && prev.kind != sqlTokenClose
+	case token.text == "(" && prev.kind == sqlTokenWord:
+		lower := strings.ToLower(prev.text)
+		if sqlOperatorWords[lower] {
+			return true
+		}
+		if isSqlFunction(lower) {
+			return false
+		}
+		if sqlFormatKeywords[lower] {
+			return true
+		}
+		return token.spaceBefore
+	case token.text == "(" && prev.kind == sqlTokenClose:
+		return token.spaceBefore
+	}
+	return true
+}
+
+// breakAfter breaks the line before the next token, unless that token is a
+// comment on the same line.
+func (f *sqlFormatter) breakAfter(level int, blank bool) {
+	f.pending = &sqlBreak{level: level, blank: blank}
+}
+
+func (f *sqlFormatter) newline(level int, blank bool) {
+	f.pending = nil
+	if len(f.line) > 0 {
+		f.flush()
+		if blank {
+			f.lines = append(f.lines, "")
+		}
+	}
+	f.lineLevel = level
+}
+
+func (f *sqlFormatter) flush() {
+	if len(f.line) > 0 {
+		f.lines = append(f.lines, strings.Repeat(f.indent, f.lineLevel)+strings.Join(f.line, ""))
+	}
+	f.line = nil
+}
+
+// formatSqlCell formats the SQL of a %sql cell, keeping its magic command
+// line and the "# MAGIC " prefix on every line.
+func formatSqlCell(body []string, options lsp.SQLFormatOptions, tabSize int) ([]string, bool) {
+	var contents []string
+	for _, line := range body {
+		content, _, _ := magicContent(line)
+		contents = append(contents, content)
+	}
+
+	command := strings.Fields(contents[0])
+	if len(command) == 0 || !strings.HasPrefix(command[0], "%") {
+		return nil, false
+	}
+
+	formatted, ok := formatSql(stripMagicCommand(strings.Join(contents, "\n")), options, tabSize)
+	if !ok {
+		return nil, false
+	}
+
+	lines := []string{"# MAGIC " + command[0]}
+	for _, line := range formatted {
+		lines = append(lines, strings.TrimRight("# MAGIC "+line, " "))
+	}
+	return lines, true
+}
+
+// formatSparkSqlStrings formats the SQL of spark.sql calls on triple quoted
+// strings that start on a new line, indenting it to match the first line of
+// the string. Strings with escapes are left alone.
+func formatSparkSqlStrings(source string, options lsp.SQLFormatOptions, tabSize int) string {
+	var formatted strings.Builder
+
+	for {
+		match := sparkSqlTripleQuote.FindStringSubmatchIndex(source)
+		if match == nil {
+			break
+		}
+		quote := source[match[2]:match[3]]
+		start := match[1]
+		end := strings.Index(source[start:], quote)
+		if end < 0 {
+			break
+		}
+		end += start
+
+		formatted.WriteString(source[:start])
+		formatted.WriteString(formatSparkSqlString(source[start:end], options, tabSize))
+		formatted.WriteString(quote)
+		source = source[end+len(quote):]
+	}
+
+	formatted.WriteString(source)
+	return formatted.String()
+}
+
+func formatSparkSqlString(content string, options lsp.SQLFormatOptions, tabSize int) string {
+	lines := strings.Split(content, "\n")
+	closing := lines[len(lines)-1]
+	if len(lines) < 3 || strings.TrimSpace(lines[0]) != "" || strings.TrimSpace(closing) != "" || strings.Contains(content, "\\") {
+		return content
+	}
+
+	var indent string
+	for _, line := range lines[1 : len(lines)-1] {
+		if strings.TrimSpace(line) != "" {
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			break
+		}
+	}
+
+	sql, ok := formatSql(strings.Join(lines[1:len(lines)-1], "\n"), options, tabSize)
+	if !ok || len(sql) == 0 {
+		return content
+	}
+
+	formatted := []string{lines[0]}
+	for _, line := range sql {
+		formatted = append(formatted, strings.TrimRight(indent+line, " "))
+	}
+	return strings.Join(append(formatted, closing), "\n")
+}
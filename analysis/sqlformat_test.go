@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatSql(t *testing.T) {
+	sql := `with totals as (select id, sum(amount) as total from sales where day between 1 and 7 and region = 'eu' group by id)
+select t.id, t.total, case when t.total > 0 then 'up' else 'down' end as trend -- direction
+from totals t left join users u on u.id = t.id where u.id in (select id from active) order by 2 desc;`
+
+	expected := `WITH totals AS (
+    SELECT id,
+        SUM(amount) AS total
+    FROM sales
+    WHERE day BETWEEN 1 AND 7
+        AND region = 'eu'
+    GROUP BY id
+)
+SELECT t.id,
+    t.total,
+    CASE WHEN t.total > 0 THEN 'up' ELSE 'down' END AS trend -- direction
+FROM totals t
+LEFT JOIN users u ON u.id = t.id
+WHERE u.id IN (
+    SELECT id
+    FROM active
+)
+ORDER BY 2 DESC;`
+
+	lines, ok := formatSql(sql, lsp.SQLFormatOptions{}, 4)
+	if got := strings.Join(lines, "\n"); !ok || got != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	again, _ := formatSql(expected, lsp.SQLFormatOptions{}, 4)
+	if got := strings.Join(again, "\n"); got != expected {
+		t.Fatalf("Expected formatting to be stable, Got:\n%s", got)
+	}
+
+	lines, _ = formatSql("SELECT Count(*) FROM ${env}.t WHERE a = 1", lsp.SQLFormatOptions{KeywordCase: "lower", IndentWidth: 2}, 4)
+	if got := strings.Join(lines, "\n"); got != "select count(*)\nfrom ${env}.t\nwhere a = 1" {
+		t.Fatalf("Expected lower case keywords, Got:\n%s", got)
+	}
+
+	if _, ok := formatSql("SELECT 'unterminated", lsp.SQLFormatOptions{}, 4); ok {
+		t.Fatalf("Expected unterminated strings to be left alone")
+	}
+}
+
+func TestFormatSqlCellsAndStrings(t *testing.T) {
+	doc := `# Databricks notebook source
+df = spark.sql("""
+    select a, b from t where a = 1
+""")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC select a,b
+# MAGIC
+# MAGIC from t`
+
+	expected := `# Databricks notebook source
+df = spark.sql("""
+    SELECT a,
+        b
+    FROM t
+    WHERE a = 1
+""")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT a,
+# MAGIC     b
+# MAGIC FROM t`
+
+	edits := formatCells(doc, nil, nil, lsp.SQLFormatOptions{}, 4, log.New(os.Stderr, "", 0))
+	if got := applyTextEdits(doc, edits); got != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+}
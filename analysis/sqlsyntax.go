@@ -0,0 +1,956 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlSyntaxError is a syntax error between two offsets of the SQL text.
+type sqlSyntaxError struct {
+	start   int
+	end     int
+	message string
+}
+
+// sqlBailout carries a syntax error up from deep in the parser.
+type sqlBailout struct {
+	err sqlSyntaxError
+}
+
+// sqlReservedWords cannot name a column, table or alias, so they end the
+// expression or list before them.
+var sqlReservedWords = map[string]bool{
+	"all": true, "and": true, "anti": true, "as": true, "asc": true, "between": true,
+	"by": true, "cluster": true, "cross": true, "desc": true, "distinct": true,
+	"distribute": true, "else": true, "end": true, "except": true, "from": true,
+	"full": true, "group": true, "having": true, "ilike": true, "in": true,
+	"inner": true, "intersect": true, "into": true, "is": true, "join": true,
+	"lateral": true, "left": true, "like": true, "limit": true, "minus": true,
+	"natural": true, "not": true, "nulls": true, "offset": true, "on": true,
+	"or": true, "order": true, "over": true, "pivot": true, "qualify": true,
+	"regexp": true, "right": true, "rlike": true, "select": true, "semi": true,
+	"sort": true, "tablesample": true, "then": true, "union": true, "unpivot": true,
+	"using": true, "values": true, "when": true, "where": true, "window": true,
+	"with": true,
+}
+
+// sqlSpecialFunctions take keywords between their arguments, so their
+// arguments are only checked for balanced parentheses.
+var sqlSpecialFunctions = map[string]bool{
+	"extract": true, "trim": true, "substring": true, "position": true,
+	"overlay": true, "listagg": true, "string_agg": true,
+}
+
+// sqlTypedLiterals may be followed by a string to make a literal of their
+// type, as in DATE '2024-01-01'.
+var sqlTypedLiterals = map[string]bool{
+	"date": true, "timestamp": true, "timestamp_ntz": true, "timestamp_ltz": true,
+	"binary": true,
+}
+
+var sqlIntervalUnits = map[string]bool{
+	"year": true, "years": true, "month": true, "months": true, "week": true,
+	"weeks": true, "day": true, "days": true, "hour": true, "hours": true,
+	"minute": true, "minutes": true, "second": true, "seconds": true,
+	"millisecond": true, "milliseconds": true, "microsecond": true,
+	"microseconds": true, "to": true,
+}
+
+var sqlComparisons = map[string]bool{
+	"=": true, "==": true, "<>": true, "!=": true, "<": true, "<=": true,
+	">": true, ">=": true, "<=>": true,
+}
+
+var sqlArithmetic = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true, "||": true,
+	"&": true, "|": true, "^": true, "<<": true, ">>": true,
+}
+
+// sqlSyntaxErrors checks each statement of some SQL and returns the first
+// syntax error of each. Queries are parsed in full. Other statements are only
+// checked for balanced brackets and for the query they hold after AS, or after
+// INSERT, as their grammar is too large to check without false alarms.
+func sqlSyntaxErrors(sql string) []sqlSyntaxError {
+	tokens, err := tokenizeSql(sql)
+	if err != nil {
+		return []sqlSyntaxError{*err}
+	}
+
+	var errs []sqlSyntaxError
+	var statement []sqlToken
+	for i, token := range tokens {
+		if !token.isComment() && token.kind != sqlTokenSemicolon {
+			statement = append(statement, token)
+		}
+		if token.kind != sqlTokenSemicolon && i < len(tokens)-1 {
+			continue
+		}
+		if len(statement) > 0 {
+			if err := parseSqlStatement(statement); err != nil {
+				errs = append(errs, *err)
+			}
+		}
+		statement = nil
+	}
+
+	return errs
+}
+
+func unterminatedSql(sql string, start int, what string) *sqlSyntaxError {
+	end := strings.IndexByte(sql[start:], '\n')
+	if end < 0 {
+		end = len(sql) - start
+	}
+	return &sqlSyntaxError{start: start, end: start + end, message: fmt.Sprintf("Unterminated %s", what)}
+}
+
+func parseSqlStatement(tokens []sqlToken) (err *sqlSyntaxError) {
+	if err := checkSqlBrackets(tokens); err != nil {
+		return err
+	}
+
+	p := sqlParser{tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			bailout, ok := r.(sqlBailout)
+			if !ok {
+				panic(r)
+			}
+			err = &bailout.err
+		}
+	}()
+
+	p.accept("explain")
+	p.accept("extended", "codegen", "cost", "formatted")
+
+	start, ok := p.embeddedQuery()
+	if !ok {
+		return nil
+	}
+	p.pos = start
+	p.query()
+	if p.peek().kind != sqlTokenEnd {
+		p.fail("the end of the statement")
+	}
+	return nil
+}
+
+// checkSqlBrackets reports the first bracket without a partner.
+func checkSqlBrackets(tokens []sqlToken) *sqlSyntaxError {
+	var open []sqlToken
+	for _, token := range tokens {
+		switch token.kind {
+		case sqlTokenOpen:
+			open = append(open, token)
+		case sqlTokenClose:
+			if len(open) == 0 {
+				return tokenSyntaxError(token, fmt.Sprintf("Unmatched `%s`", token.text))
+			}
+			last := open[len(open)-1]
+			if (last.text == "(") != (token.text == ")") {
+				return tokenSyntaxError(token, fmt.Sprintf("`%s` does not close `%s`", token.text, last.text))
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		last := open[len(open)-1]
+		return tokenSyntaxError(last, fmt.Sprintf("`%s` is never closed", last.text))
+	}
+	return nil
+}
+
+func tokenSyntaxError(token sqlToken, message string) *sqlSyntaxError {
+	return &sqlSyntaxError{start: token.offset, end: token.offset + len(token.text), message: message}
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// embeddedQuery finds where the query of a statement starts: at its start for
+// a query, after the first top level AS for statements such as CREATE TABLE,
+// and at the first top level SELECT, WITH or VALUES of an INSERT.
+func (p *sqlParser) embeddedQuery() (int, bool) {
+	if p.isQueryStart(p.pos) {
+		return p.pos, true
+	}
+	insert := p.peek().isWord("insert")
+
+	depth := 0
+	for i := p.pos; i < len(p.tokens); i++ {
+		switch token := p.tokens[i]; {
+		case token.kind == sqlTokenOpen:
+			depth++
+		case token.kind == sqlTokenClose:
+			depth--
+		case depth > 0:
+		case insert && token.isWord("select", "with", "values"):
+			return i, true
+		case !insert && token.isWord("as") && p.isQueryStart(i+1):
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func (p *sqlParser) isQueryStart(i int) bool {
+	if i >= len(p.tokens) {
+		return false
+	}
+	token := p.tokens[i]
+	if token.text == "(" {
+		return p.isQueryStart(i + 1)
+	}
+	return token.isWord("select", "with", "values")
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.peekAt(0)
+}
+
+func (p *sqlParser) peekAt(n int) sqlToken {
+	if p.pos+n >= len(p.tokens) {
+		end := 0
+		if len(p.tokens) > 0 {
+			last := p.tokens[len(p.tokens)-1]
+			end = last.offset + len(last.text)
+		}
+		return sqlToken{kind: sqlTokenEnd, offset: end}
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return token
+}
+
+func (p *sqlParser) accept(words ...string) bool {
+	if p.peek().isWord(words...) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) acceptText(text string) bool {
+	if token := p.peek(); token.text == text && token.kind != sqlTokenLiteral {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(word string) {
+	if !p.accept(word) {
+		p.fail(strings.ToUpper(word))
+	}
+}
+
+func (p *sqlParser) expectText(text string) {
+	if !p.acceptText(text) {
+		p.fail(fmt.Sprintf("`%s`", text))
+	}
+}
+
+// fail stops parsing with an error at the next token.
+func (p *sqlParser) fail(expected string) {
+	token := p.peek()
+	message := fmt.Sprintf("Syntax error at or near `%s`: expected %s", token.text, expected)
+	if token.kind == sqlTokenEnd {
+		message = fmt.Sprintf("Unexpected end of statement: expected %s", expected)
+		if len(p.tokens) > 0 {
+			token = p.tokens[len(p.tokens)-1]
+		}
+	}
+	panic(sqlBailout{*tokenSyntaxError(token, message)})
+}
+
+// atListEnd reports whether the next token ends a list or expression.
+func (p *sqlParser) atListEnd() bool {
+	token := p.peek()
+	return token.kind == sqlTokenEnd || token.kind == sqlTokenClose ||
+		(token.kind == sqlTokenWord && sqlReservedWords[strings.ToLower(token.text)])
+}
+
+// list parses items separated by commas, reporting a missing comma between
+// two items.
+func (p *sqlParser) list(item func(), what string) {
+	for {
+		item()
+		if p.acceptText(",") {
+			continue
+		}
+		if !p.atListEnd() {
+			p.fail("`,` between " + what)
+		}
+		return
+	}
+}
+
+func (p *sqlParser) query() {
+	if p.accept("with") {
+		p.accept("recursive")
+		for {
+			p.identifier("a name for the CTE")
+			if p.peek().text == "(" {
+				p.identifierList()
+			}
+			p.accept("as")
+			p.subquery()
+			if !p.acceptText(",") {
+				break
+			}
+		}
+	}
+
+	p.queryTerm()
+	for p.accept("union", "intersect", "except", "minus") {
+		p.accept("all", "distinct")
+		p.queryTerm()
+	}
+
+	for {
+		switch {
+		case p.accept("order", "sort"):
+			p.expect("by")
+			p.list(p.sortItem, "sort keys")
+		case p.accept("cluster", "distribute"):
+			p.expect("by")
+			p.list(p.value, "expressions")
+		case p.accept("limit"):
+			if !p.accept("all") {
+				p.expression()
+			}
+		case p.accept("offset"):
+			p.expression()
+		default:
+			return
+		}
+	}
+}
+
+func (p *sqlParser) subquery() {
+	p.expectText("(")
+	p.query()
+	p.expectText(")")
+}
+
+func (p *sqlParser) queryTerm() {
+	switch {
+	case p.peek().text == "(":
+		p.subquery()
+	case p.accept("select"):
+		p.selectClause()
+	case p.accept("values"):
+		p.list(p.value, "rows")
+	case p.accept("from"):
+		p.relations()
+		p.expect("select")
+		p.selectClause()
+	case p.accept("table"):
+		p.qualifiedName()
+	default:
+		p.fail("SELECT")
+	}
+}
+
+func (p *sqlParser) selectClause() {
+	p.accept("all", "distinct")
+	p.list(p.selectItem, "select items")
+
+	if p.accept("from") {
+		p.relations()
+	}
+	for p.accept("lateral") {
+		p.expect("view")
+		p.accept("outer")
+		p.expression()
+		if p.isIdentifier(p.peek()) {
+			p.next()
+		}
+		if p.accept("as") {
+			p.list(func() { p.identifier("a column name") }, "column names")
+		}
+	}
+	if p.accept("where") {
+		p.expression()
+	}
+	if p.accept("group") {
+		p.expect("by")
+		switch {
+		case p.accept("all"):
+		case p.accept("grouping"):
+			p.expect("sets")
+			p.skipParenthesised()
+		default:
+			p.list(p.value, "grouping expressions")
+			if p.accept("with") {
+				if !p.accept("rollup", "cube") {
+					p.fail("ROLLUP or CUBE")
+				}
+			}
+		}
+	}
+	if p.accept("having") {
+		p.expression()
+	}
+	if p.accept("window") {
+		p.list(func() {
+			p.identifier("a window name")
+			p.expect("as")
+			p.skipParenthesised()
+		}, "windows")
+	}
+	if p.accept("qualify") {
+		p.expression()
+	}
+}
+
+func (p *sqlParser) selectItem() {
+	if p.acceptText("*") {
+		p.starExcept()
+		return
+	}
+	if p.expression() {
+		p.starExcept()
+		return
+	}
+	p.alias()
+}
+
+// starExcept parses the column list of "* EXCEPT (a, b)".
+func (p *sqlParser) starExcept() {
+	if p.peek().isWord("except") && p.peekAt(1).text == "(" {
+		p.next()
+		p.skipParenthesised()
+	}
+}
+
+// alias parses an optional alias, which may name several columns.
+func (p *sqlParser) alias() {
+	if p.accept("as") {
+		if p.peek().text == "(" {
+			p.identifierList()
+			return
+		}
+		p.identifier("an alias")
+	} else if p.isIdentifier(p.peek()) {
+		p.next()
+	} else {
+		return
+	}
+	if p.peek().text == "(" {
+		p.identifierList()
+	}
+}
+
+func (p *sqlParser) isIdentifier(token sqlToken) bool {
+	switch token.kind {
+	case sqlTokenWord:
+		return !sqlReservedWords[strings.ToLower(token.text)]
+	case sqlTokenLiteral:
+		return strings.HasPrefix(token.text, "`") || strings.HasPrefix(token.text, "{") || strings.HasPrefix(token.text, "$")
+	}
+	return false
+}
+
+func (p *sqlParser) identifier(what string) {
+	if !p.isIdentifier(p.peek()) {
+		p.fail(what)
+	}
+	p.next()
+}
+
+func (p *sqlParser) identifierList() {
+	p.expectText("(")
+	p.list(func() { p.identifier("a column name") }, "column names")
+	p.expectText(")")
+}
+
+func (p *sqlParser) qualifiedName() {
+	p.identifier("a name")
+	for p.acceptText(".") {
+		p.identifier("a name")
+	}
+}
+
+// skipParenthesised steps over a bracketed group, which is known to be
+// balanced.
+func (p *sqlParser) skipParenthesised() {
+	p.expectText("(")
+	for depth := 1; depth > 0; {
+		switch p.next().kind {
+		case sqlTokenOpen:
+			depth++
+		case sqlTokenClose:
+			depth--
+		case sqlTokenEnd:
+			return
+		}
+	}
+}
+
+func (p *sqlParser) relations() {
+	p.list(func() {
+		p.relation()
+		for {
+			switch {
+			case p.peek().isWord("lateral") && p.peekAt(1).isWord("view"):
+				p.relation()
+			case p.joinStart():
+				p.relation()
+				switch {
+				case p.accept("on"):
+					p.expression()
+				case p.accept("using"):
+					p.identifierList()
+				}
+			default:
+				return
+			}
+		}
+	}, "tables")
+}
+
+// joinStart parses the words of a join, such as LEFT OUTER JOIN.
+func (p *sqlParser) joinStart() bool {
+	start := p.pos
+	p.accept("natural")
+	p.accept("inner", "cross", "left", "right", "full")
+	p.accept("outer", "semi", "anti")
+	if p.accept("join") {
+		return true
+	}
+	if p.pos != start {
+		p.fail("JOIN")
+	}
+	return false
+}
+
+func (p *sqlParser) relation() {
+	switch {
+	case p.peek().text == "(" && p.isQueryStart(p.pos+1):
+		p.subquery()
+	case p.peek().text == "(":
+		p.next()
+		p.relations()
+		p.expectText(")")
+	case p.accept("lateral"):
+		if p.accept("view") {
+			p.lateralView()
+			return
+		}
+		p.subquery()
+	case p.accept("values"):
+		p.list(p.value, "rows")
+	default:
+		if p.peek().isWord("stream") && p.isIdentifier(p.peekAt(1)) {
+			p.next()
+		}
+		p.qualifiedName()
+		if p.peek().text == "(" {
+			p.arguments()
+		}
+		if p.acceptText("@") {
+			p.next()
+		}
+	}
+
+	if (p.peek().isWord("version", "timestamp")) && p.peekAt(1).isWord("as") && p.peekAt(2).isWord("of") {
+		p.pos += 3
+		p.expression()
+	}
+	if p.accept("tablesample", "pivot", "unpivot") {
+		p.accept("include", "exclude")
+		p.accept("nulls")
+		p.skipParenthesised()
+	}
+	p.alias()
+}
+
+// lateralView parses the rest of LATERAL VIEW [OUTER] generator(...), with
+// its table alias and column names.
+func (p *sqlParser) lateralView() {
+	p.accept("outer")
+	p.qualifiedName()
+	p.arguments()
+	if p.isIdentifier(p.peek()) {
+		p.next()
+	}
+	if p.accept("as") || p.isIdentifier(p.peek()) {
+		p.identifier("a column name")
+		for p.acceptText(",") {
+			p.identifier("a column name")
+		}
+	}
+}
+
+func (p *sqlParser) sortItem() {
+	p.expression()
+	p.accept("asc", "desc")
+	if p.accept("nulls") && !p.accept("first", "last") {
+		p.fail("FIRST or LAST")
+	}
+}
+
+// value parses an expression in a list.
+func (p *sqlParser) value() {
+	p.expression()
+}
+
+// expression parses an expression. It reports whether the expression ended
+// in ".*", which selects every column of a table.
+func (p *sqlParser) expression() bool {
+	star := p.and()
+	for p.accept("or") {
+		star = p.and()
+	}
+	return star
+}
+
+func (p *sqlParser) and() bool {
+	star := p.not()
+	for p.accept("and") {
+		star = p.not()
+	}
+	return star
+}
+
+func (p *sqlParser) not() bool {
+	if p.accept("not") {
+		return p.not()
+	}
+	return p.predicate()
+}
+
+func (p *sqlParser) predicate() bool {
+	star := p.additive()
+
+	for {
+		token := p.peek()
+		switch {
+		case token.kind == sqlTokenOperator && sqlComparisons[token.text]:
+			p.next()
+			p.accept("any", "all", "some")
+			star = p.additive()
+			continue
+		case token.isWord("is"):
+			p.next()
+			p.accept("not")
+			switch {
+			case p.accept("null", "true", "false", "unknown"):
+			case p.accept("distinct"):
+				p.expect("from")
+				p.additive()
+			default:
+				p.fail("NULL, TRUE, FALSE or DISTINCT FROM")
+			}
+			continue
+		}
+
+		negated := p.accept("not")
+		switch {
+		case p.accept("between"):
+			p.additive()
+			p.expect("and")
+			p.additive()
+		case p.accept("in"):
+			p.expectText("(")
+			if p.isQueryStart(p.pos) {
+				p.query()
+			} else {
+				p.list(p.value, "values")
+			}
+			p.expectText(")")
+		case p.accept("like", "ilike", "rlike", "regexp"):
+			if p.accept("any", "all", "some") {
+				p.skipParenthesised()
+			} else {
+				p.additive()
+			}
+			if p.accept("escape") {
+				p.additive()
+			}
+		case negated:
+			p.fail("BETWEEN, IN or LIKE after NOT")
+		default:
+			return star
+		}
+		star = false
+	}
+}
+
+func (p *sqlParser) additive() bool {
+	star := p.unary()
+	for {
+		token := p.peek()
+		if !(token.kind == sqlTokenOperator && sqlArithmetic[token.text]) && !token.isWord("div") {
+			return star
+		}
+		p.next()
+		star = p.unary()
+	}
+}
+
+func (p *sqlParser) unary() bool {
+	if token := p.peek(); token.kind == sqlTokenOperator && strings.Contains("+-~!", token.text) && len(token.text) == 1 {
+		p.next()
+		return p.unary()
+	}
+	return p.postfix()
+}
+
+func (p *sqlParser) postfix() bool {
+	p.primary()
+
+	for {
+		switch token := p.peek(); {
+		case token.kind == sqlTokenDot:
+			p.next()
+			if p.acceptText("*") {
+				return true
+			}
+			if field := p.peek(); field.kind != sqlTokenWord && !p.isIdentifier(field) {
+				p.fail("a field name")
+			}
+			p.next()
+		case token.text == "[":
+			p.next()
+			p.expression()
+			p.expectText("]")
+		case token.text == ":" && p.peekAt(1).kind != sqlTokenOperator:
+			p.next()
+			if p.peek().text != "[" {
+				p.next()
+			}
+		case token.text == "::":
+			p.next()
+			p.dataType()
+		case token.text == "->":
+			p.next()
+			p.expression()
+		default:
+			return false
+		}
+	}
+}
+
+func (p *sqlParser) primary() {
+	token := p.peek()
+	word := strings.ToLower(token.text)
+
+	switch {
+	case token.kind == sqlTokenLiteral:
+		p.next()
+		for isSqlString(token) && isSqlString(p.peek()) {
+			p.next()
+		}
+
+	case token.text == "?" || token.text == "*":
+		p.next()
+
+	case token.text == ":" && p.peekAt(1).kind == sqlTokenWord:
+		p.pos += 2
+
+	case token.text == "(":
+		p.next()
+		if p.isQueryStart(p.pos) {
+			p.query()
+		} else {
+			p.list(p.value, "values")
+		}
+		p.expectText(")")
+
+	case token.kind != sqlTokenWord:
+		p.fail("an expression")
+
+	case word == "case":
+		p.next()
+		if !p.peek().isWord("when") {
+			p.expression()
+		}
+		for p.accept("when") {
+			p.expression()
+			p.expect("then")
+			p.expression()
+		}
+		if p.accept("else") {
+			p.expression()
+		}
+		p.expect("end")
+
+	case (word == "cast" || word == "try_cast") && p.peekAt(1).text == "(":
+		p.pos += 2
+		p.expression()
+		p.expect("as")
+		p.dataType()
+		p.expectText(")")
+
+	case word == "exists" && p.peekAt(1).text == "(" && p.isQueryStart(p.pos+1):
+		p.next()
+		p.subquery()
+
+	case word == "interval":
+		p.next()
+		p.acceptText("-")
+		for p.peek().kind == sqlTokenLiteral || sqlIntervalUnits[strings.ToLower(p.peek().text)] {
+			p.next()
+		}
+
+	case sqlTypedLiterals[word] && isSqlString(p.peekAt(1)):
+		p.pos += 2
+
+	case p.peekAt(1).text == "(" && (!sqlReservedWords[word] || word == "left" || word == "right"):
+		p.next()
+		if sqlSpecialFunctions[word] {
+			p.skipParenthesised()
+		} else {
+			p.arguments()
+		}
+		p.callSuffix()
+
+	case sqlReservedWords[word]:
+		p.fail("an expression")
+
+	default:
+		p.next()
+	}
+}
+
+func isSqlString(token sqlToken) bool {
+	return token.kind == sqlTokenLiteral && (strings.HasPrefix(token.text, "'") || strings.HasPrefix(token.text, `"`))
+}
+
+func (p *sqlParser) arguments() {
+	p.expectText("(")
+	if p.acceptText(")") {
+		return
+	}
+	p.accept("distinct", "all")
+	p.list(func() {
+		p.expression()
+		if p.acceptText("=>") {
+			p.expression()
+		}
+	}, "arguments")
+	p.expectText(")")
+}
+
+// callSuffix parses the clauses that may follow an aggregate or window
+// function call.
+func (p *sqlParser) callSuffix() {
+	if p.accept("within") {
+		p.expect("group")
+		p.skipParenthesised()
+	}
+	if p.accept("filter") {
+		p.skipParenthesised()
+	}
+	if p.accept("ignore", "respect") {
+		p.expect("nulls")
+	}
+	if p.accept("over") {
+		if p.peek().text == "(" {
+			p.skipParenthesised()
+		} else {
+			p.identifier("a window")
+		}
+	}
+}
+
+// dataType parses a type such as DECIMAL(10, 2) or ARRAY<STRUCT<a: INT>>.
+func (p *sqlParser) dataType() {
+	word := strings.ToLower(p.peek().text)
+	p.identifier("a type")
+
+	switch {
+	case p.peek().text == "(":
+		p.skipParenthesised()
+	case p.peek().text == "<":
+		p.next()
+		for {
+			if word == "struct" {
+				p.identifier("a field name")
+				p.acceptText(":")
+			}
+			p.dataType()
+			if p.accept("not") {
+				p.expect("null")
+			}
+			if p.accept("comment") {
+				p.next()
+			}
+			if !p.acceptText(",") {
+				break
+			}
+		}
+		p.closeAngle()
+	case word == "interval":
+		for sqlIntervalUnits[strings.ToLower(p.peek().text)] {
+			p.next()
+		}
+	}
+}
+
+// closeAngle ends a type parameter list, splitting the ">>" that closes two
+// nested lists.
+func (p *sqlParser) closeAngle() {
+	if p.peek().text == ">>" {
+		p.tokens[p.pos].text = ">"
+		p.tokens[p.pos].offset++
+		return
+	}
+	p.expectText(">")
+}
+
+// sqlSyntaxMessages reports the syntax errors of every %sql cell. The magic
+// command is blanked rather than removed, so that offsets into the SQL still
+// line up with the cell.
+func sqlSyntaxMessages(doc string) []errorMessage {
+	var messages []errorMessage
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "sql" {
+			continue
+		}
+
+		source := c.sqlSource()
+		for _, err := range sqlSyntaxErrors(strings.Join(source, "\n")) {
+			start := c.sourcePosition(source, err.start)
+			end := c.sourcePosition(source, err.end)
+			messages = append(messages, errorMessage{
+				line:     start.Line + 1,
+				char:     start.Character + 1,
+				endLine:  end.Line + 1,
+				endChar:  end.Character + 1,
+				code:     "syntax-error",
+				desc:     err.message,
+				source:   "SQL",
+				severity: 1,
+			})
+		}
+	}
+
+	return messages
+}
+
+// sqlSource returns the lines of a %sql cell with the magic command blanked
+// out, so that offsets into the SQL map straight back to the cell.
+func (c cell) sqlSource() []string {
+	source := c.source()
+	for i, line := range source {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "%") {
+			command := len(line) - len(trimmed) + len(strings.Fields(trimmed)[0])
+			source[i] = strings.Repeat(" ", command) + line[command:]
+			break
+		}
+	}
+	return source
+}
@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"testing"
+)
+
+func TestSqlSyntaxErrors(t *testing.T) {
+	valid := []string{
+		`WITH a AS (SELECT id, sum(x) AS total FROM t GROUP BY id) SELECT a.*, b.name FROM a LEFT JOIN b ON a.id = b.id WHERE a.total BETWEEN 1 AND 2`,
+		`SELECT count(*), col:field::int, cast(a AS decimal(10, 2)), transform(xs, x -> x + 1) FROM ${env}.sales WHERE d = :day`,
+		`CREATE OR REPLACE TABLE t USING DELTA AS SELECT 1 AS id; INSERT INTO t VALUES (1), (2)`,
+		`OPTIMIZE t ZORDER BY (a, b)`,
+		`SELECT * FROM STREAM read_files('/x')`,
+		`SELECT * FROM t@v2 JOIN u@20240101000000000 x ON t.id = x.id`,
+		`SELECT * FROM t, LATERAL VIEW explode(a)`,
+		`SELECT id, x FROM t LATERAL VIEW OUTER explode(a) e AS x WHERE x > 1`,
+		`SELECT exists(xs, x -> x > 1) FROM t WHERE EXISTS (SELECT 1 FROM u)`,
+	}
+	for _, sql := range valid {
+		if errs := sqlSyntaxErrors(sql); len(errs) > 0 {
+			t.Fatalf("Expected no errors in %q, Got: %+v", sql, errs)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		near     string
+		expected string
+	}{
+		{"SELECT a b c FROM t", "c", "Syntax error at or near `c`: expected `,` between select items"},
+		{"SELECT a, FROM t", "FROM", "Syntax error at or near `FROM`: expected an expression"},
+		{"SELECT (a + b FROM t", "(", "`(` is never closed"},
+		{"SELECT 1; SELECT a FROM t WHERE x = 'oops", "'oops", "Unterminated string"},
+	}
+	for _, test := range tests {
+		errs := sqlSyntaxErrors(test.sql)
+		if len(errs) != 1 || errs[0].message != test.expected || test.sql[errs[0].start:errs[0].end] != test.near {
+			t.Fatalf("Expected %q at %q in %q, Got: %+v", test.expected, test.near, test.sql, errs)
+		}
+	}
+}
+
+func TestSqlSyntaxMessages(t *testing.T) {
+	doc := `# Databricks notebook source
+# MAGIC %sql
+# MAGIC SELECT 1;
+# MAGIC SELECT a,
+# MAGIC FROM t`
+
+	messages := sqlSyntaxMessages(doc)
+	if len(messages) != 1 || messages[0].line != 5 || messages[0].char != 9 || messages[0].endChar != 13 {
+		t.Fatalf("Expected an error on FROM, Got: %+v", messages)
+	}
+}
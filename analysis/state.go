@@ -2,13 +2,13 @@ package analysis
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"myfirstlsp/lsp"
 	"os"
 	"os/exec"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -23,12 +23,31 @@ type document struct {
 
 type State struct {
 	Documents     map[string]string
-	LinterResults map[string]string
+	LinterResults map[string][]errorMessage
+	LintLineMaps  map[string][]int
+	WorkspaceRoot string
+	SQLFormat     lsp.SQLFormatOptions
+	Linters       map[string]bool
+	CatalogFile   string
+	WatchFiles    bool
+
+	// PullDiagnostics is set when the client asks for diagnostics, rather
+	// than having them published after each change.
+	PullDiagnostics bool
+
+	importFixes map[string][]errorMessage
+	catalog     *catalog
+	index       *workspaceIndex
+	parsed      map[string]parsedNotebook
+	diagnosed   map[string]diagnosedNotebook
 }
 
 func NewState() State {
 	return State{Documents: map[string]string{},
-		LinterResults: map[string]string{}}
+		LinterResults: map[string][]errorMessage{},
+		LintLineMaps:  map[string][]int{},
+		importFixes:   map[string][]errorMessage{},
+		index:         newWorkspaceIndex()}
 }
 
 func (s *State) OpenDocument(uri, text string) {
@@ -44,17 +63,65 @@ func (s *State) CacheDocument(uri string) error {
 	filePath := GetTempPath()
 	fileName := GetTempFileName(uri)
 
-	doc := newDocument(s.Documents[uri])
+	contents, lineMap := s.lintSource(uri)
+	s.LintLineMaps[uri] = lineMap
+
+	doc := newDocument(contents)
 
 	err := os.WriteFile(fmt.Sprintf("%s.temp_%s", filePath, fileName), []byte(doc.contents), 0644)
 
 	return err
 }
 
+// lintBackend is a linter that can be switched on or off by name.
+type lintBackend struct {
+	name    string
+	enabled bool
+	run     func(s *State, uri string, logger *log.Logger) ([]errorMessage, error)
+}
+
+var lintBackends = []lintBackend{
+	{name: "ruff", enabled: true, run: (*State).ruffMessages},
+	{name: "mypy", enabled: true, run: (*State).mypyMessages},
+	{name: "sqlfluff", enabled: false, run: (*State).sqlfluffMessages},
+}
+
+func (s *State) linterEnabled(backend lintBackend) bool {
+	if enabled, found := s.Linters[backend.name]; found {
+		return enabled
+	}
+	return backend.enabled
+}
+
+// LintDocument runs each enabled linter over a document. A linter that fails
+// does not stop the others.
 func (s *State) LintDocument(uri string, logger *log.Logger) error {
+	var messages []errorMessage
+	var errs []error
+	delete(s.importFixes, uri)
+
+	for _, backend := range lintBackends {
+		if !s.linterEnabled(backend) {
+			continue
+		}
+		backendMessages, err := backend.run(s, uri, logger)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.name, err))
+			continue
+		}
+		messages = append(messages, backendMessages...)
+	}
+
+	fillEndPosition(messages, s.Documents[uri])
+	s.LinterResults[uri] = messages
+
+	return errors.Join(errs...)
+}
+
+func (s *State) ruffMessages(uri string, logger *log.Logger) ([]errorMessage, error) {
 	execPath, err := exec.LookPath("ruff")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	filePath := GetTempPath()
@@ -62,60 +129,107 @@ func (s *State) LintDocument(uri string, logger *log.Logger) error {
 
 	linterRes, err := getLintedResults(execPath, fmt.Sprintf("%s.temp_%s", filePath, fileName))
 	if err != nil {
-		return fmt.Errorf("Error: %s: linter Result: %s", err, linterRes)
+		return nil, fmt.Errorf("Error: %s: linter Result: %s", err, linterRes)
 	}
-	execPath, err = exec.LookPath("mypy")
-	logger.Println(execPath)
+
+	messages, err := parseRuffResults(linterRes)
 	if err != nil {
-		logger.Printf("Error in pyright: %s", err)
-		return err
+		return nil, fmt.Errorf("Error: %s: linter Result: %s", err, linterRes)
 	}
-	typeRes, err := getTypeResults(execPath, fmt.Sprintf("%s.temp_%s", filePath, fileName), logger)
 
-	if err != nil {
-		return fmt.Errorf("Error: %s: type Result: %s", err, linterRes)
+	// The organize imports action needs ruff's import sorting whether or not
+	// the project's configuration reports it, so it runs on its own.
+	if imports, err := s.organizeImportsMessages(uri); err != nil {
+		logger.Printf("Error finding import fixes: %s", err)
+	} else {
+		s.importFixes[uri] = imports
 	}
 
-	lines := strings.Split(linterRes, "\n")
-	lines = append(lines, strings.Split(typeRes, "\n")...)
-	//lines := strings.Split(typeRes, "\n")
+	return mapLintLines(messages, s.LintLineMaps[uri]), nil
+}
 
-	var pythonLines []string
-	for _, l := range lines {
-		if strings.Contains(l, ".py") {
-			pythonLines = append(pythonLines, l)
-		}
+func (s *State) mypyMessages(uri string, logger *log.Logger) ([]errorMessage, error) {
+	execPath, err := exec.LookPath("mypy")
+	logger.Println(execPath)
+	if err != nil {
+		return nil, err
 	}
 
-	s.LinterResults[uri] = strings.Join(pythonLines, "\n")
+	filePath := GetTempPath()
+	fileName := GetTempFileName(uri)
 
-	return nil
+	typeRes, err := getTypeResults(execPath, fmt.Sprintf("%s.temp_%s", filePath, fileName), logger)
+	if err != nil {
+		return nil, fmt.Errorf("Error: %s: type Result: %s", err, typeRes)
+	}
+	return mapLintLines(parseTypeResults(typeRes), s.LintLineMaps[uri]), nil
 }
 
 func (s *State) Hover(id int, uri string, position lsp.Position, logger *log.Logger) *lsp.HoverResponse {
 
-	res := s.LinterResults[uri]
+	response := lsp.HoverResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	doc := s.Documents[uri]
+	if sqlText, ok := sqlTextBeforePosition(doc, position); ok {
+		line := splitCellIntoLines(doc)[position.Line]
+		statement := sqlStatementAt(sqlText, sqlTextAfterPosition(doc, position))
+		value, found := s.currentCatalog().catalogDocumentation(line, position.Character, statement)
+		if definitions := s.tableDefinitionsAt(uri, position); !found && len(definitions) > 0 {
+			value, found = s.tableDefinitionDocumentation(definitions), true
+		}
+		if !found {
+			value, found = sqlWordDocumentation(line, position.Character)
+		}
+		if found {
+			response.Result = &lsp.HoverResult{
+				Contents: lsp.MarkupContent{
+					Kind:  lsp.MarkupKindMarkdown,
+					Value: value,
+				},
+			}
+			return &response
+		}
+	}
 
-	lineNoMessage := parseLinterMessages(res, position.Line+1, logger)
+	if line, ok := pythonLineAt(doc, position.Line); ok {
+		value, found := dbutilsDocumentation(line, position.Character)
+		if definitions := s.tableDefinitionsAt(uri, position); !found && len(definitions) > 0 {
+			value, found = s.tableDefinitionDocumentation(definitions), true
+		}
+		if found {
+			response.Result = &lsp.HoverResult{
+				Contents: lsp.MarkupContent{
+					Kind:  lsp.MarkupKindMarkdown,
+					Value: value,
+				},
+			}
+			return &response
+		}
+	}
 
-	if lineNoMessage != nil {
-		value := *lineNoMessage
-		logger.Printf("Errors Message: %s", value)
+	var messages []string
+	for _, msg := range s.reportedMessages(uri) {
+		if msg.contains(position) {
+			messages = append(messages, msg.markdown())
+		}
+	}
 
-		response := lsp.HoverResponse{
-			Response: lsp.Response{
-				RPC: "2.0",
-				ID:  &id,
-			},
-			Result: lsp.HoverResult{
-				Contents: value,
+	if len(messages) > 0 {
+		response.Result = &lsp.HoverResult{
+			Contents: lsp.MarkupContent{
+				Kind:  lsp.MarkupKindMarkdown,
+				Value: strings.Join(messages, "\n\n---\n\n"),
 			},
 		}
-		return &response
 	} else {
 		logger.Printf("No Linter message")
 	}
-	return nil
+	return &response
 }
 
 func panicOnErr(err error) {
@@ -125,65 +239,10 @@ func panicOnErr(err error) {
 }
 
 func (s *State) PublishDiagnostics(uri string, logger *log.Logger) *lsp.PublishDiagnosticNotification {
-	logger.Println(s.LinterResults[uri])
-	lines := strings.Split(s.LinterResults[uri], "\n")
-	var errorMsgs []errorMessage
 	var diagnostics []lsp.Diagnostic
 
-	isNotebook := strings.Contains(s.Documents[uri], "# Databricks notebook source")
-
-	for _, line := range lines {
-		if strings.Contains(line, ".py") {
-			errorStr := strings.Split(line, ".py:")
-			errorString := errorStr[len(errorStr)-1]
-			lineNo, err := strconv.Atoi(strings.Split(errorString, ":")[0])
-			panicOnErr(err)
-			char, err := strconv.Atoi(strings.Split(errorString, ":")[1])
-			panicOnErr(err)
-			errorString = strings.Join(strings.Split(errorString, ":")[2:], " ")
-
-			errorString = strings.Trim(errorString, " ")
-			errorWords := strings.Split(errorString, " ")
-
-			code := errorWords[0]
-			desc := strings.Join(errorWords[1:], " ")
-
-			severity := 3
-			if strings.Contains(code, "E") || strings.Contains(code, "warning") {
-				severity = 2
-			} else if strings.Contains(code, "F") || strings.Contains(code, "error") {
-				severity = 1
-			}
-
-			if !strings.Contains(desc, "[name-defined]") && (isNotebook && !strings.Contains(desc, "Undefined name `spark`") && !strings.Contains(desc, "Undefined name `dbutils`")) {
-				errorMsgs = append(errorMsgs, errorMessage{
-					line:     lineNo,
-					char:     char,
-					code:     code,
-					desc:     desc,
-					source:   "Ruff",
-					severity: severity,
-				})
-			}
-		}
-	}
-
-	for _, msg := range errorMsgs {
-		diagnostics = append(diagnostics, lsp.Diagnostic{
-			Range: lsp.Range{
-				StartPosition: lsp.Position{
-					Line:      msg.line - 1,
-					Character: 0},
-				EndPosition: lsp.Position{
-					Line:      msg.line - 1,
-					Character: 1001},
-			},
-			Severity: msg.severity,
-			Code:     msg.code,
-			Source:   msg.source,
-			Message:  msg.desc,
-		})
-
+	for _, msg := range s.reportedMessages(uri) {
+		diagnostics = append(diagnostics, msg.diagnostic())
 	}
 
 	response := lsp.PublishDiagnosticNotification{
@@ -201,6 +260,47 @@ func (s *State) PublishDiagnostics(uri string, logger *log.Logger) *lsp.PublishD
 
 }
 
+// reportedMessages returns the messages shown to the user for an open
+// document.
+func (s *State) reportedMessages(uri string) []errorMessage {
+	return s.notebookMessages(s.Documents[uri], s.LinterResults[uri])
+}
+
+// notebookMessages filters the linter results down to the ones shown to the
+// user and adds the dbutils, widget, SQL syntax and catalog checks. Names from
+// %run includes and the notebook globals are defined in the lint file itself.
+// Mypy messages about the generated dbutils protocols are dropped, as the
+// dbutils checks cover them, as are messages silenced by a noqa comment the
+// linters cannot see.
+func (s *State) notebookMessages(doc string, linted []errorMessage) []errorMessage {
+	if !isNotebook(doc) {
+		return nil
+	}
+
+	var messages []errorMessage
+	for _, msg := range linted {
+		if !strings.Contains(msg.desc, dbutilsProtocolPrefix) {
+			messages = append(messages, msg)
+		}
+	}
+
+	messages = append(messages, dbutilsMessages(doc)...)
+	messages = append(messages, widgetMessages(doc)...)
+	messages = append(messages, sqlSyntaxMessages(doc)...)
+	if cat := s.currentCatalog(); cat != nil {
+		messages = append(messages, catalogMessages(doc, cat, s.definedTableNames())...)
+	}
+
+	lines := splitCellIntoLines(doc)
+	var reported []errorMessage
+	for _, msg := range messages {
+		if !suppressedByNoqa(lines, msg) {
+			reported = append(reported, msg)
+		}
+	}
+	return reported
+}
+
 func getPyRightResults(uri string, logger *log.Logger) {
 
 }
@@ -208,54 +308,57 @@ func getPyRightResults(uri string, logger *log.Logger) {
 type errorMessage struct {
 	line     int
 	char     int
+	endLine  int
+	endChar  int
 	code     string
 	desc     string
 	source   string
 	severity int
+	url      string
+	fix      *lintFix
 }
 
 func (s *State) SemanticFormat(id int, uri string, logger *log.Logger) *lsp.SemanticTokenResponse {
 
 	doc := s.Documents[uri]
 
-	isDatabricksNotebook := strings.Contains(strings.ToLower(doc), "# databricks notebook source")
-	containsSql := strings.Contains(strings.ToLower(doc), "# magic %sql")
+	var tokenList []token
 
-	if isDatabricksNotebook && containsSql {
+	if isNotebook(doc) {
+		tokenList = append(tokenList, findMarkerTokens(doc)...)
 
-		var intList []int
-		var tokenList []token
+		for _, c := range splitIntoCells(doc) {
+			if c.language != "sql" && c.language != "python" {
+				tokenList = append(tokenList, findMagicCellTokens(c)...)
+			}
+		}
 
-		sqlCells, cellStartLineNo := splitIntoSQLCells(doc)
-		for i, cell := range sqlCells {
+		for _, c := range splitIntoSQLCells(doc) {
+			cellText := strings.Join(c.lines, "\n")
 
-			allTokenList := findTokenInCell(cell, cellStartLineNo[i], logger)
-			stringTokenList := CreateStringTokens(cell, cellStartLineNo[i], "\"", logger)
-			stringTokenList = append(stringTokenList, CreateStringTokens(cell, cellStartLineNo[i], "'", logger)...)
+			allTokenList := findTokenInCell(c, logger)
+			stringTokenList := CreateStringTokens(cellText, c.startLine+1, "\"", logger)
+			stringTokenList = append(stringTokenList, CreateStringTokens(cellText, c.startLine+1, "'", logger)...)
 			tokenList = append(tokenList, mergeTokenLists(allTokenList, stringTokenList)...)
-			//tokenList = append(tokenList, stringTokenList...)
 		}
+	} else {
+		logger.Println("Not a notebook")
+	}
 
-		tokenList = orderTokenList(tokenList)
-		intList = append(intList, encodeTokenList(tokenList, logger)...)
-
-		response := lsp.SemanticTokenResponse{
-			Response: lsp.Response{
-				RPC: "2.0",
-				ID:  &id,
-			},
+	tokenList = orderTokenList(tokenList)
 
-			Result: lsp.SemanticTokenResult{
-				Data: intListToUint(intList),
-			},
-		}
+	response := lsp.SemanticTokenResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
 
-		return &response
-	} else {
-		logger.Println("Not a notebook and doesn't contain sql")
+		Result: lsp.SemanticTokenResult{
+			Data: intListToUint(encodeTokenList(tokenList, logger)),
+		},
 	}
-	return nil
 
+	return &response
 }
 
 func mergeTokenLists(allTokenList, stringTokenList []token) []token {
@@ -264,7 +367,7 @@ func mergeTokenLists(allTokenList, stringTokenList []token) []token {
 	for _, t1 := range allTokenList {
 		overlap = false
 		for _, t2 := range stringTokenList {
-			if t1.absStartIndex > t2.absStartIndex && t1.absStartIndex < t2.absStartIndex+t2.length && t1.absLineNo == t2.absLineNo {
+			if t1.absStartIndex >= t2.absStartIndex && t1.absStartIndex < t2.absStartIndex+t2.length && t1.absLineNo == t2.absLineNo {
 				overlap = true
 			}
 
@@ -280,7 +383,7 @@ func mergeTokenLists(allTokenList, stringTokenList []token) []token {
 }
 
 func intListToUint(intList []int) []uint {
-	var newList []uint
+	newList := []uint{}
 
 	for _, i := range intList {
 		newList = append(newList, uint(i))
@@ -300,14 +403,15 @@ type token struct {
 	tokenModifiers     *int // TODO: make this generic
 }
 
-func findTokenInCell(cell string, startLineNo int, logger *log.Logger) []token {
+func findTokenInCell(c cell, logger *log.Logger) []token {
 	var tokenList []token
 
-	cells := splitCellIntoLines(cell)
-
-	for i, line := range cells {
+	for i, line := range c.lines {
+		if _, _, isMagic := magicContent(line); !isMagic {
+			continue
+		}
 		tokenList = append(tokenList,
-			findTokenInLine(line, i+startLineNo, logger)...,
+			findTokenInLine(line, c.startLine+i, logger)...,
 		)
 	}
 	return tokenList
@@ -371,17 +475,6 @@ func encodeToken(t *token, prevLineNo int, prevStartIndex int) (int, int) {
 		t.relativeStartIndex = &(startIndex)
 	}
 
-	word := strings.ReplaceAll(t.tokenValue, "(", "")
-	word = strings.ReplaceAll(word, ")", "")
-
-	if inList(word, GetSqlTokens()) {
-		sqlTokenType := 1
-		t.tokenType = &sqlTokenType
-	} else if inList(word, GetSqlFunctions()) {
-		sqlTokenType := 2
-		t.tokenType = &sqlTokenType
-	}
-
 	return t.absLineNo, t.absStartIndex
 
 }
@@ -393,9 +486,9 @@ func findTokenInLine(line string, lineNo int, logger *log.Logger) []token {
 	words := SplitStringWithPosition(line)
 
 	for word, positions := range words {
-		if word != "spaces" && word != "#" && word != "magic" {
+		if word != "spaces" && word != "#" && !strings.EqualFold(word, "magic") && !strings.HasPrefix(word, "%") {
 
-			defaultTokentype := 0
+			defaultTokentype := classifySqlWord(word)
 			defaultTokenModifiers := 0
 
 			for _, position := range positions {
@@ -403,7 +496,7 @@ func findTokenInLine(line string, lineNo int, logger *log.Logger) []token {
 				tokenList = append(tokenList,
 					token{
 						tokenValue:     word,
-						absLineNo:      lineNo - 1,
+						absLineNo:      lineNo,
 						absStartIndex:  position,
 						length:         len(word),
 						tokenType:      &defaultTokentype,
@@ -421,42 +514,21 @@ func splitCellIntoLines(cell string) []string {
 	return lines
 }
 
-func splitIntoSQLCells(doc string) ([]string, []int) {
-	allCells := strings.Split(strings.ToLower(doc), "# command ----------")
-
-	var sqlCells []string
-	var numberSqlCellLines []int
-	var numberCellLines []int
-
-	for _, cell := range allCells {
-		lines := splitCellIntoLines(cell)
-		numberCellLines = append(numberCellLines, len(lines))
-	}
-
-	for i, cell := range allCells {
-
-		if strings.Contains(cell, "# magic %sql") {
-			sqlCells = append(sqlCells, cell)
-			numberSqlCellLines = append(numberSqlCellLines, sum(numberCellLines[:i]))
+func splitIntoSQLCells(doc string) []cell {
+	var sqlCells []cell
 
+	for _, c := range splitIntoCells(doc) {
+		if c.language == "sql" {
+			sqlCells = append(sqlCells, c)
 		}
 	}
-	return sqlCells, numberSqlCellLines
-}
-
-func sum(nums []int) int {
-	total := 0
-
-	for _, num := range nums {
-		total += num
-	}
-
-	return total
+	return sqlCells
 }
 
-func getLintedResults(execPath string, id string) (string, error) {
+func getLintedResults(execPath string, id string, args ...string) (string, error) {
 
-	command := exec.Command(execPath, "check", id)
+	args = append([]string{"check", "--output-format", "json"}, args...)
+	command := exec.Command(execPath, append(args, id)...)
 
 	// set var to get the output
 	var out bytes.Buffer
@@ -505,68 +577,3 @@ func getTypeResults(execPath string, id string, logger *log.Logger) (string, err
 	}
 
 }
-
-func parseLinterMessages(messages string, lineNo int, logger *log.Logger) *string {
-
-	switch messages {
-	case "All checks passed successfully":
-		return nil
-	}
-
-	lines := strings.Split(messages, "\n")
-
-	lines = remove(lines, ".py")
-	for _, line := range lines {
-
-		errorMessages := strings.Split(line, ".py:")
-		errorMessage := errorMessages[len(errorMessages)-1]
-		errorLineNumber, err := strconv.Atoi(strings.Split(errorMessage, ":")[0])
-
-		if err != nil {
-			logger.Printf("Errorr: %s", err)
-			panic(err)
-		}
-
-		if errorLineNumber == lineNo {
-			styleViolations := strings.Split(errorMessage, ":")[2:]
-			styleViolationsString := strings.Join(styleViolations, " ")
-
-			return &styleViolationsString
-		}
-
-	}
-	return nil
-}
-
-func remove(s []string, match string) []string {
-	number_of_replaces := 0
-	for i, e := range s {
-		if !strings.Contains(e, match) {
-			number_of_replaces++
-			s[i] = s[len(s)-number_of_replaces]
-		}
-	}
-
-	if number_of_replaces > 0 {
-		return s[:len(s)-number_of_replaces]
-	}
-	return s
-}
-
-func inList(s string, l []string) bool {
-	for _, e := range l {
-		if s == e {
-			return true
-		}
-	}
-	return false
-}
-
-func inListInt(s int, l []int) bool {
-	for _, e := range l {
-		if s == e {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,161 @@
+package analysis
+
+import (
+	"fmt"
+	"myfirstlsp/lsp"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	pythonNoqaComment = regexp.MustCompile(`(?i)#\s*noqa(?::\s*([\w-]+(?:\s*,\s*[\w-]+)*))?`)
+	magicNoqaComment  = regexp.MustCompile(`(?i)(?:--|//|#|<!--)\s*noqa(?::\s*([\w-]+(?:\s*,\s*[\w-]+)*))?`)
+	typeIgnoreComment = regexp.MustCompile(`#\s*type:\s*ignore(?:\[([^\]]*)\])?`)
+)
+
+// magicCommentSyntax is how a comment is written in each kind of magic cell.
+// A noqa comment in this form is honoured by the server, as the linters only
+// see magic lines as Python comments.
+var magicCommentSyntax = map[string][2]string{
+	"python": {"# ", ""},
+	"sql":    {"-- ", ""},
+	"scala":  {"// ", ""},
+	"r":      {"# ", ""},
+	"sh":     {"# ", ""},
+	"md":     {"<!-- ", " -->"},
+}
+
+// suppressAction returns an action that silences a message on its line, with
+// "# type: ignore[code]" for mypy and a noqa comment for everything else.
+func suppressAction(uri, doc string, msg errorMessage) (lsp.CodeAction, bool) {
+	lines := splitCellIntoLines(doc)
+	if msg.code == "syntax-error" || msg.line < 1 || msg.line > len(lines) {
+		return lsp.CodeAction{}, false
+	}
+
+	line := strings.TrimRight(lines[msg.line-1], "\r")
+	content, offset, isMagic := magicContent(line)
+
+	var suppressed string
+	var ok bool
+	title := fmt.Sprintf("Suppress %s on this line", msg.code)
+
+	switch {
+	case isMagic:
+		c, _ := cellAt(doc, msg.line-1)
+		syntax, known := magicCommentSyntax[c.language]
+		if !known || strings.HasPrefix(strings.TrimSpace(content), "%") {
+			return lsp.CodeAction{}, false
+		}
+		suppressed, ok = addNoqa(content, msg.code, magicNoqaComment, syntax)
+		suppressed = line[:offset] + suppressed
+	case msg.source == "mypy":
+		suppressed, ok = addTypeIgnore(line, msg)
+		title = fmt.Sprintf("Ignore mypy %s on this line", msg.code)
+	default:
+		suppressed, ok = addNoqa(line, msg.code, pythonNoqaComment, magicCommentSyntax["python"])
+	}
+	if !ok {
+		return lsp.CodeAction{}, false
+	}
+
+	edit := lsp.TextEdit{
+		Range: lsp.Range{
+			StartPosition: lsp.Position{Line: msg.line - 1},
+			EndPosition:   lsp.Position{Line: msg.line - 1, Character: len(line)},
+		},
+		NewText: suppressed,
+	}
+
+	return lsp.CodeAction{
+		Title:       title,
+		Kind:        lsp.CodeActionKindQuickFix,
+		Diagnostics: []lsp.Diagnostic{msg.diagnostic()},
+		Edit: &lsp.WorkspaceEdit{
+			Changes: map[string][]lsp.TextEdit{uri: {edit}},
+		},
+	}, true
+}
+
+// addNoqa adds a code to the noqa comment of a line, or ends the line with a
+// new one. It reports false when the line already suppresses the code.
+func addNoqa(line, code string, comment *regexp.Regexp, syntax [2]string) (string, bool) {
+	match := comment.FindStringSubmatchIndex(line)
+	if match == nil {
+		return fmt.Sprintf("%s  %snoqa: %s%s", strings.TrimRight(line, " \t"), syntax[0], code, syntax[1]), true
+	}
+	if match[2] < 0 || slices.Contains(splitCodes(line[match[2]:match[3]]), code) {
+		return line, false
+	}
+	return line[:match[3]] + ", " + code + line[match[3]:], true
+}
+
+// addTypeIgnore adds the error code of a mypy message to the type: ignore
+// comment of a line. A new comment goes before any other comment on the line,
+// as mypy only reads it at the start of a comment.
+func addTypeIgnore(line string, msg errorMessage) (string, bool) {
+	comment := "# type: ignore"
+	if msg.url != "" {
+		comment += "[" + msg.code + "]"
+	}
+
+	match := typeIgnoreComment.FindStringSubmatchIndex(line)
+	switch {
+	case match == nil:
+	case match[2] < 0 || msg.url == "" || slices.Contains(splitCodes(line[match[2]:match[3]]), msg.code):
+		return line, false
+	case strings.TrimSpace(line[match[2]:match[3]]) == "":
+		return line[:match[2]] + msg.code + line[match[3]:], true
+	default:
+		return line[:match[3]] + ", " + msg.code + line[match[3]:], true
+	}
+
+	if start := pythonCommentStart(line); start >= 0 {
+		return line[:start] + comment + "  " + line[start:], true
+	}
+	return strings.TrimRight(line, " \t") + "  " + comment, true
+}
+
+// pythonCommentStart returns the offset of the "#" starting the comment of a
+// line of Python, or -1 when there is none.
+func pythonCommentStart(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && !inPythonString(line[:i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func splitCodes(list string) []string {
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// suppressedByNoqa reports whether a noqa comment on the line of a message
+// names its code, or names no codes at all. Python lines only honour "#"
+// comments, while magic lines honour the comments of their cell language.
+// Mypy messages are left to "# type: ignore".
+func suppressedByNoqa(lines []string, msg errorMessage) bool {
+	if msg.source == "mypy" || msg.line < 1 || msg.line > len(lines) {
+		return false
+	}
+
+	comment := pythonNoqaComment
+	content, _, isMagic := magicContent(lines[msg.line-1])
+	if isMagic {
+		comment = magicNoqaComment
+	}
+
+	match := comment.FindStringSubmatch(content)
+	if match == nil {
+		return false
+	}
+	return match[1] == "" || slices.Contains(splitCodes(match[1]), msg.code)
+}
@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"testing"
+)
+
+const suppressNotebook = `# Databricks notebook source
+import os  # noqa: E401
+total = add(1, "2")  # keep this
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC SELECT * FROM very_long_table_name;
+# MAGIC SELECT 1 -- noqa: E501`
+
+func TestSuppressActions(t *testing.T) {
+	tests := []struct {
+		msg      errorMessage
+		expected string
+	}{
+		{errorMessage{line: 2, code: "F401", source: "Ruff"}, "import os  # noqa: E401, F401"},
+		{errorMessage{line: 3, code: "arg-type", source: "mypy", url: mypyErrorCodeDocs + "arg-type"}, `total = add(1, "2")  # type: ignore[arg-type]  # keep this`},
+		{errorMessage{line: 8, code: "E501", source: "Ruff"}, "# MAGIC SELECT * FROM very_long_table_name;  -- noqa: E501"},
+	}
+
+	for _, test := range tests {
+		action, ok := suppressAction("file:///nb.py", suppressNotebook, test.msg)
+		if !ok {
+			t.Fatalf("Expected a suppression for %s", test.msg.code)
+		}
+		if got := action.Edit.Changes["file:///nb.py"][0].NewText; got != test.expected {
+			t.Fatalf("Expected: %q, Got: %q", test.expected, got)
+		}
+	}
+
+	if _, ok := suppressAction("file:///nb.py", suppressNotebook, errorMessage{line: 2, code: "E401", source: "Ruff"}); ok {
+		t.Fatalf("Expected no suppression for a code that is already suppressed")
+	}
+}
+
+func TestReportedMessagesHonourSQLNoqa(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", suppressNotebook)
+	state.LinterResults["file:///nb.py"] = []errorMessage{
+		{line: 8, char: 1, endLine: 8, endChar: 10, code: "E501", source: "Ruff"},
+		{line: 9, char: 1, endLine: 9, endChar: 10, code: "E501", source: "Ruff"},
+	}
+
+	messages := state.reportedMessages("file:///nb.py")
+	if len(messages) != 1 || messages[0].line != 8 {
+		t.Fatalf("Expected the message on the noqa line to be dropped, Got: %+v", messages)
+	}
+}
@@ -0,0 +1,314 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"regexp"
+	"strings"
+)
+
+var (
+	pythonDefinition   = regexp.MustCompile(`^(\s*)(?:async\s+)?(def|class)\s+(\w+)`)
+	sqlCreateStatement = regexp.MustCompile("(?i)\\bcreate\\s+(?:or\\s+replace\\s+)?(?:(global\\s+)?(temp(?:orary)?\\s+)|materialized\\s+|streaming\\s+)?(table|view)\\s+(?:if\\s+not\\s+exists\\s+)?([A-Za-z_][\\w.]*|`[^`]+`)")
+)
+
+// cellNameLength is how much of the first line is used to name an untitled cell.
+const cellNameLength = 40
+
+// outlineEntry is a symbol whose nesting is decided by its level, the
+// indentation of a Python definition or the depth of a Markdown heading.
+type outlineEntry struct {
+	level  int
+	symbol lsp.DocumentSymbol
+}
+
+func (s *State) DocumentSymbols(id int, uri string, logger *log.Logger) *lsp.DocumentSymbolResponse {
+
+	symbols := []lsp.DocumentSymbol{}
+
+	doc := s.Documents[uri]
+	if isNotebook(doc) {
+		for _, c := range splitIntoCells(doc) {
+			if symbol, ok := cellSymbol(c); ok {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	logger.Printf("Found %d cell symbols", len(symbols))
+
+	response := lsp.DocumentSymbolResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: symbols,
+	}
+
+	return &response
+}
+
+// cellSymbol describes a cell, named by its title or by its language and first
+// line. Cells with nothing in them are skipped.
+func cellSymbol(c cell) (lsp.DocumentSymbol, bool) {
+	lineNo, firstLine, found := c.firstLine()
+	if !found {
+		return lsp.DocumentSymbol{}, false
+	}
+
+	name := c.title
+	if name == "" {
+		if len(firstLine) > cellNameLength {
+			firstLine = firstLine[:cellNameLength] + "..."
+		}
+		name = fmt.Sprintf("%s: %s", c.language, firstLine)
+	}
+
+	symbol := lsp.DocumentSymbol{
+		Name:           name,
+		Detail:         c.language,
+		Kind:           lsp.SymbolKindModule,
+		Range:          lineRange(c.lines, c.startLine, c.startLine, c.startLine+len(c.lines)-1),
+		SelectionRange: lineRange(c.lines, c.startLine, lineNo, lineNo),
+	}
+
+	switch c.language {
+	case "python":
+		symbol.Children = pythonSymbols(c)
+	case "sql":
+		symbol.Children = sqlSymbols(c)
+	case "md":
+		symbol.Children = markdownSymbols(c)
+	}
+
+	return symbol, true
+}
+
+// firstLine returns the first line of code in a cell, leaving out the
+// notebook markers and the magic command itself. The title line counts when
+// the cell is otherwise empty.
+func (c cell) firstLine() (int, string, bool) {
+	titleLine := -1
+
+	for i, line := range c.lines {
+		if isHeaderLine(line) {
+			continue
+		}
+		if isTitleLine(line) {
+			titleLine = c.startLine + i
+			continue
+		}
+
+		content := strings.TrimSpace(magicCellContent(line))
+		if content != "" {
+			return c.startLine + i, content, true
+		}
+	}
+
+	if titleLine >= 0 && c.title != "" {
+		return titleLine, "", true
+	}
+	return 0, "", false
+}
+
+// magicCellContent strips the "# MAGIC" prefix and any %command from a line.
+func magicCellContent(line string) string {
+	content, _, isMagic := magicContent(line)
+	if isMagic && strings.HasPrefix(strings.TrimSpace(content), "%") {
+		content = stripMagicCommand(content)
+	}
+	return content
+}
+
+// lineRange covers whole lines of a cell, given as absolute line numbers.
+func lineRange(lines []string, startLine, first, last int) lsp.Range {
+	return lsp.Range{
+		StartPosition: lsp.Position{Line: first, Character: 0},
+		EndPosition:   lsp.Position{Line: last, Character: len(strings.TrimRight(lines[last-startLine], "\r"))},
+	}
+}
+
+func pythonSymbols(c cell) []lsp.DocumentSymbol {
+	var entries []outlineEntry
+
+	for i, line := range c.lines {
+		match := pythonDefinition.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		indent := match[3] - match[2]
+
+		kind := lsp.SymbolKindFunction
+		if line[match[4]:match[5]] == "class" {
+			kind = lsp.SymbolKindClass
+		} else if parent := enclosingEntry(entries, indent); parent != nil && parent.symbol.Kind == lsp.SymbolKindClass {
+			kind = lsp.SymbolKindMethod
+		}
+
+		last := pythonBlockEnd(c.lines, i, indent)
+		lineNo := c.startLine + i
+
+		entries = append(entries, outlineEntry{
+			level: indent,
+			symbol: lsp.DocumentSymbol{
+				Name:  line[match[6]:match[7]],
+				Kind:  kind,
+				Range: lineRange(c.lines, c.startLine, lineNo, c.startLine+last),
+				SelectionRange: lsp.Range{
+					StartPosition: lsp.Position{Line: lineNo, Character: match[6]},
+					EndPosition:   lsp.Position{Line: lineNo, Character: match[7]},
+				},
+			},
+		})
+	}
+
+	return nestSymbols(entries)
+}
+
+func enclosingEntry(entries []outlineEntry, level int) *outlineEntry {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].level < level {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// pythonBlockEnd returns the index of the last line belonging to the block
+// that starts at index start.
+func pythonBlockEnd(lines []string, start, indent int) int {
+	last := start
+
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line)-len(strings.TrimLeft(line, " \t")) <= indent {
+			break
+		}
+		last = i
+	}
+
+	return last
+}
+
+func sqlSymbols(c cell) []lsp.DocumentSymbol {
+	var symbols []lsp.DocumentSymbol
+
+	source := c.source()
+	sql := strings.Join(source, "\n")
+
+	for _, match := range sqlCreateStatement.FindAllStringSubmatchIndex(sql, -1) {
+		end := len(sql)
+		if semicolon := strings.IndexByte(sql[match[1]:], ';'); semicolon >= 0 {
+			end = match[1] + semicolon + 1
+		}
+
+		symbols = append(symbols, lsp.DocumentSymbol{
+			Name:   strings.Trim(sql[match[8]:match[9]], "`"),
+			Detail: strings.ToUpper(sql[match[6]:match[7]]),
+			Kind:   lsp.SymbolKindStruct,
+			Range: lsp.Range{
+				StartPosition: c.sourcePosition(source, match[0]),
+				EndPosition:   c.sourcePosition(source, end),
+			},
+			SelectionRange: lsp.Range{
+				StartPosition: c.sourcePosition(source, match[8]),
+				EndPosition:   c.sourcePosition(source, match[9]),
+			},
+		})
+	}
+
+	return symbols
+}
+
+// sourcePosition turns an offset into the joined cell source back into a
+// position in the document, allowing for the stripped "# MAGIC " prefixes.
+func (c cell) sourcePosition(source []string, offset int) lsp.Position {
+	line := 0
+	for line < len(source)-1 && offset > len(source[line]) {
+		offset -= len(source[line]) + 1
+		line++
+	}
+
+	_, prefix, _ := magicContent(c.lines[line])
+	return lsp.Position{Line: c.startLine + line, Character: prefix + offset}
+}
+
+func markdownSymbols(c cell) []lsp.DocumentSymbol {
+	var entries []outlineEntry
+	inFence := false
+
+	for i, line := range c.lines {
+		content, offset, isMagic := magicContent(line)
+		if !isMagic {
+			continue
+		}
+		trimmed := strings.TrimSpace(magicCellContent(line))
+
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || !isMarkdownHeading(trimmed) {
+			continue
+		}
+
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		name := strings.TrimSpace(trimmed[level:])
+		if name == "" {
+			continue
+		}
+
+		lineNo := c.startLine + i
+		start := offset + strings.Index(content, trimmed)
+		entries = append(entries, outlineEntry{
+			level: level,
+			symbol: lsp.DocumentSymbol{
+				Name: name,
+				Kind: lsp.SymbolKindString,
+				SelectionRange: lsp.Range{
+					StartPosition: lsp.Position{Line: lineNo, Character: start},
+					EndPosition:   lsp.Position{Line: lineNo, Character: start + len(trimmed)},
+				},
+			},
+		})
+	}
+
+	// A heading runs until the next heading of the same or a higher level.
+	for i := range entries {
+		last := c.startLine + len(c.lines) - 1
+		for _, next := range entries[i+1:] {
+			if next.level <= entries[i].level {
+				last = next.symbol.SelectionRange.StartPosition.Line - 1
+				break
+			}
+		}
+		first := entries[i].symbol.SelectionRange.StartPosition.Line
+		entries[i].symbol.Range = lineRange(c.lines, c.startLine, first, last)
+	}
+
+	return nestSymbols(entries)
+}
+
+// nestSymbols turns a flat list of entries into a tree, placing each entry
+// under the closest earlier entry with a lower level.
+func nestSymbols(entries []outlineEntry) []lsp.DocumentSymbol {
+	var symbols []lsp.DocumentSymbol
+
+	for len(entries) > 0 {
+		end := 1
+		for end < len(entries) && entries[end].level > entries[0].level {
+			end++
+		}
+
+		symbol := entries[0].symbol
+		symbol.Children = nestSymbols(entries[1:end])
+		symbols = append(symbols, symbol)
+
+		entries = entries[end:]
+	}
+
+	return symbols
+}
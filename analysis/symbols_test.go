@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+const symbolNotebook = `# Databricks notebook source
+class Loader:
+    def load(self):
+        return 1
+
+# COMMAND ----------
+
+# DBTITLE 1,Build tables
+# MAGIC %sql
+# MAGIC CREATE OR REPLACE TEMP VIEW recent AS
+# MAGIC SELECT * FROM raw;
+
+# COMMAND ----------
+
+# MAGIC %md
+# MAGIC # Report
+# MAGIC ## Details`
+
+func TestDocumentSymbols(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", symbolNotebook)
+
+	symbols := state.DocumentSymbols(1, "file:///nb.py", log.New(os.Stderr, "", 0)).Result
+	if len(symbols) != 3 {
+		t.Fatalf("Expected 3 cells, Got: %+v", symbols)
+	}
+
+	python := symbols[0]
+	if python.Name != "python: class Loader:" || len(python.Children) != 1 {
+		t.Fatalf("Expected python cell with a class, Got: %+v", python)
+	}
+	if method := python.Children[0].Children[0]; method.Name != "load" || method.Kind != lsp.SymbolKindMethod {
+		t.Fatalf("Expected load method, Got: %+v", method)
+	}
+
+	sql := symbols[1]
+	if sql.Name != "Build tables" || len(sql.Children) != 1 || sql.Children[0].Name != "recent" || sql.Children[0].Detail != "VIEW" {
+		t.Fatalf("Expected titled sql cell with the recent view, Got: %+v", sql)
+	}
+	if start := sql.Children[0].SelectionRange.StartPosition; start.Line != 9 || start.Character != 36 {
+		t.Fatalf("Expected view name at 9:36, Got: %+v", start)
+	}
+
+	md := symbols[2]
+	if len(md.Children) != 1 || md.Children[0].Name != "Report" || md.Children[0].Children[0].Name != "Details" {
+		t.Fatalf("Expected nested headings, Got: %+v", md)
+	}
+}
@@ -0,0 +1,259 @@
+package analysis
+
+import (
+	"fmt"
+	"myfirstlsp/lsp"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	sparkTableCall = regexp.MustCompile(`\btable\(\s*["']([^"'\n]+)["']`)
+)
+
+// tableDefinition is a table or view created by a CREATE statement or a
+// createOrReplaceTempView call, and where its name is written. The name is
+// written in SQL unless it is passed to createOrReplaceTempView.
+type tableDefinition struct {
+	name      string
+	kind      string
+	statement string
+	uri       string
+	nameRange lsp.Range
+	sql       bool
+}
+
+// findTableDefinitions lists the tables and views a notebook creates in its
+// %sql cells and in the spark.sql strings and temp view calls of its Python
+// cells.
+func findTableDefinitions(uri, doc string) []tableDefinition {
+	var definitions []tableDefinition
+
+	if !isNotebook(doc) {
+		return definitions
+	}
+
+	sqlDefinitions := func(c cell, source []string, sql string, offset int) {
+		for _, match := range sqlCreateStatement.FindAllStringSubmatchIndex(sql, -1) {
+			kind := strings.ToLower(sql[match[6]:match[7]])
+			if match[4] >= 0 {
+				kind = "temporary " + kind
+			}
+			if match[2] >= 0 {
+				kind = "global " + kind
+			}
+
+			definitions = append(definitions, tableDefinition{
+				name:      strings.Trim(sql[match[8]:match[9]], "`"),
+				kind:      kind,
+				statement: strings.Join(strings.Fields(sql[match[0]:match[1]]), " "),
+				uri:       uri,
+				nameRange: lsp.Range{
+					StartPosition: c.sourcePosition(source, offset+match[8]),
+					EndPosition:   c.sourcePosition(source, offset+match[9]),
+				},
+				sql: true,
+			})
+		}
+	}
+
+	for _, c := range splitIntoCells(doc) {
+		switch c.language {
+		case "sql":
+			source := c.sqlSource()
+			sqlDefinitions(c, source, strings.Join(source, "\n"), 0)
+
+		case "python":
+			text := strings.Join(c.lines, "\n")
+			for _, span := range sparkSqlSpans(text) {
+				if !inPythonComment(text, span.start) {
+					sqlDefinitions(c, c.lines, span.sql, span.start)
+				}
+			}
+
+			for _, match := range tempViewCall.FindAllStringSubmatchIndex(text, -1) {
+				if inPythonComment(text, match[0]) {
+					continue
+				}
+
+				kind := "temporary view"
+				if strings.Contains(text[match[0]:match[2]], "Global") {
+					kind = "global temporary view"
+				}
+				definitions = append(definitions, tableDefinition{
+					name:      text[match[2]:match[3]],
+					kind:      kind,
+					statement: strings.TrimPrefix(text[match[0]:match[1]], ".") + ")",
+					uri:       uri,
+					nameRange: lsp.Range{
+						StartPosition: c.sourcePosition(c.lines, match[2]),
+						EndPosition:   c.sourcePosition(c.lines, match[3]),
+					},
+				})
+			}
+		}
+	}
+
+	return definitions
+}
+
+// workspaceTableDefinitions lists the definitions of every notebook in the
+// workspace, the open version of a document taking the place of the file.
+func (s *State) workspaceTableDefinitions() []tableDefinition {
+	var definitions []tableDefinition
+	for _, notebook := range s.parsedNotebooks() {
+		definitions = append(definitions, notebook.tables...)
+	}
+	return definitions
+}
+
+// definedTableNames lists the tables and views created anywhere in the
+// workspace, in lower case.
+func (s *State) definedTableNames() map[string]bool {
+	names := map[string]bool{}
+	for _, definition := range s.workspaceTableDefinitions() {
+		names[strings.ToLower(definition.name)] = true
+	}
+	return names
+}
+
+// tableDefinitionsOf finds the definitions of a table name, those in the
+// given document first. A name matches a definition that is more or less
+// qualified than itself, so sales.orders finds main.sales.orders.
+func (s *State) tableDefinitionsOf(uri, name string) []tableDefinition {
+	var local, others []tableDefinition
+
+	for _, definition := range s.workspaceTableDefinitions() {
+		if !tableNamesMatch(definition.name, name) {
+			continue
+		}
+		if definition.uri == uri {
+			local = append(local, definition)
+		} else {
+			others = append(others, definition)
+		}
+	}
+
+	return append(local, others...)
+}
+
+func tableNamesMatch(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+// tableDefinitionsAt finds the definitions of the table named under the
+// cursor. A name that is not read as a table by its statement must match a
+// definition exactly, so that a column is not taken for the table it shares
+// a name with.
+func (s *State) tableDefinitionsAt(uri string, position lsp.Position) []tableDefinition {
+	name, read, ok := s.tableNameAt(uri, position)
+	if !ok {
+		return nil
+	}
+	if read {
+		return s.tableDefinitionsOf(uri, name)
+	}
+
+	var exact []tableDefinition
+	for _, definition := range s.tableDefinitionsOf(uri, name) {
+		if strings.EqualFold(definition.name, name) {
+			exact = append(exact, definition)
+		}
+	}
+	return exact
+}
+
+// tableNameAt reads the name under the cursor, either in SQL or as the string
+// passed to a temp view or spark.table call, and reports whether it is read
+// as a table. Any name in SQL is returned, as it may still be a table the
+// statement creates.
+func (s *State) tableNameAt(uri string, position lsp.Position) (string, bool, bool) {
+	doc := s.Documents[uri]
+	lines := splitCellIntoLines(doc)
+	if position.Line >= len(lines) {
+		return "", false, false
+	}
+	line := strings.TrimRight(lines[position.Line], "\r")
+
+	if sqlText, ok := sqlTextBeforePosition(doc, position); ok {
+		start, end := sqlNameBounds(line, position.Character)
+		name := strings.Trim(strings.ReplaceAll(line[start:end], "`", ""), ".")
+		if name == "" {
+			return "", false, false
+		}
+
+		refs, _ := sqlStatementTables(sqlStatementAt(sqlText, sqlTextAfterPosition(doc, position)))
+		for _, ref := range refs {
+			if strings.EqualFold(strings.Join(ref.parts, "."), name) {
+				return name, true, true
+			}
+		}
+		return name, false, true
+	}
+
+	if _, ok := pythonLineAt(doc, position.Line); !ok {
+		return "", false, false
+	}
+	for _, pattern := range []*regexp.Regexp{tempViewCall, sparkTableCall} {
+		for _, match := range pattern.FindAllStringSubmatchIndex(line, -1) {
+			if position.Character >= match[2] && position.Character <= match[3] {
+				return line[match[2]:match[3]], true, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// tableDefinitionDocumentation describes where a table is created.
+func (s *State) tableDefinitionDocumentation(definitions []tableDefinition) string {
+	first := definitions[0]
+	kind := strings.ToUpper(first.kind[:1]) + first.kind[1:]
+	doc := fmt.Sprintf("```sql\n%s\n```\n\n%s created in `%s` line %d", first.statement, kind, s.relativePath(first.uri), first.nameRange.StartPosition.Line+1)
+
+	if len(definitions) > 1 {
+		var others []string
+		for _, definition := range definitions[1:] {
+			others = append(others, fmt.Sprintf("`%s` line %d", s.relativePath(definition.uri), definition.nameRange.StartPosition.Line+1))
+		}
+		doc += "\n\nAlso created in " + strings.Join(others, ", ")
+	}
+	return doc
+}
+
+// relativePath shows a document's path relative to the workspace root.
+func (s *State) relativePath(uri string) string {
+	path := uriToPath(uri)
+	if s.WorkspaceRoot != "" {
+		if relative, err := filepath.Rel(s.WorkspaceRoot, path); err == nil && !strings.HasPrefix(relative, "..") {
+			return filepath.ToSlash(relative)
+		}
+	}
+	return path
+}
+
+// workspaceTableCompletionItems offers the tables and views created in the
+// workspace, continuing a qualified name the way tableCompletionItems does.
+func (s *State) workspaceTableCompletionItems(word string) []lsp.CompletionItem {
+	var items []lsp.CompletionItem
+
+	qualifier := ""
+	if idx := strings.LastIndex(word, "."); idx >= 0 {
+		qualifier = strings.ToLower(strings.Trim(word[:idx+1], "`"))
+	}
+
+	for _, definition := range s.workspaceTableDefinitions() {
+		name := definition.name
+		if len(name) <= len(qualifier) || !strings.HasPrefix(strings.ToLower(name), qualifier) {
+			continue
+		}
+		items = append(items, lsp.CompletionItem{
+			Label:  name[len(qualifier):],
+			Kind:   lsp.CompletionItemKindStruct,
+			Detail: fmt.Sprintf("%s · %s", definition.kind, s.relativePath(definition.uri)),
+		})
+	}
+
+	return items
+}
@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pipelineNotebook = `# Databricks notebook source
+df = spark.sql("""
+  CREATE OR REPLACE TABLE silver.orders AS SELECT * FROM bronze.orders
+""")
+df.createOrReplaceTempView("recent_orders")
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC CREATE TEMP VIEW IF NOT EXISTS ` + "`daily totals`" + ` AS SELECT 1
+`
+
+func TestFindTableDefinitions(t *testing.T) {
+	definitions := findTableDefinitions("file:///pipeline.py", pipelineNotebook)
+
+	expected := []struct {
+		name, kind string
+		line, char int
+	}{
+		{"silver.orders", "table", 2, 26},
+		{"recent_orders", "temporary view", 4, 28},
+		{"daily totals", "temporary view", 9, 39},
+	}
+	if len(definitions) != len(expected) {
+		t.Fatalf("Expected %d definitions, Got: %+v", len(expected), definitions)
+	}
+	for i, e := range expected {
+		d := definitions[i]
+		if d.name != e.name || d.kind != e.kind || d.nameRange.StartPosition != (lsp.Position{Line: e.line, Character: e.char}) {
+			t.Fatalf("Expected %s %s at %d:%d, Got: %+v", e.kind, e.name, e.line, e.char, d)
+		}
+	}
+}
+
+func TestTableDefinitionsAcrossWorkspace(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "pipeline.py"), []byte(pipelineNotebook), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(os.Stderr, "", 0)
+
+	state := NewState()
+	state.WorkspaceRoot = root
+	state.index.scan(root)
+	uri := "file:///report.py"
+	state.OpenDocument(uri, "# Databricks notebook source\n# MAGIC %sql\n# MAGIC SELECT orders FROM silver.orders JOIN recent_orders\n# MAGIC SELECT * FROM ")
+
+	definition := state.Definition(1, uri, lsp.Position{Line: 2, Character: 30}, logger).Result
+	if definition == nil || definition.URI != pathToURI(filepath.Join(root, "pipeline.py")) || definition.Range.StartPosition.Line != 2 {
+		t.Fatalf("Expected silver.orders in pipeline.py, Got: %+v", definition)
+	}
+
+	if column := state.Definition(1, uri, lsp.Position{Line: 2, Character: 17}, logger).Result; column != nil {
+		t.Fatalf("Expected no table for the orders column, Got: %+v", column)
+	}
+
+	hover := state.Hover(1, uri, lsp.Position{Line: 2, Character: 50}, logger).Result
+	if hover == nil || hover.Contents.Value != "```sql\ncreateOrReplaceTempView(\"recent_orders\")\n```\n\nTemporary view created in `pipeline.py` line 5" {
+		t.Fatalf("Expected the temp view definition, Got: %+v", hover)
+	}
+
+	var labels []string
+	for _, item := range state.Completion(1, uri, lsp.Position{Line: 3, Character: 22}, logger).Result {
+		labels = append(labels, item.Label+" ("+item.Detail+")")
+	}
+	if got := strings.Join(labels, ", "); got != "daily totals (temporary view · pipeline.py), recent_orders (temporary view · pipeline.py), silver.orders (table · pipeline.py)" {
+		t.Fatalf("Expected the workspace tables, Got: %s", got)
+	}
+}
@@ -0,0 +1,183 @@
+package analysis
+
+import (
+	"fmt"
+	"log"
+	"myfirstlsp/lsp"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	widgetDeclaration = regexp.MustCompile(`\bdbutils\.widgets\.(text|dropdown|combobox|multiselect)\(\s*(?:name\s*=\s*)?["']([^"'\n]*)["']\s*,\s*(?:defaultValue\s*=\s*)?["']([^"'\n]*)["']`)
+	widgetRead        = regexp.MustCompile(`\bdbutils\.widgets\.(?:get|getArgument)\(\s*(?:name\s*=\s*)?["']([^"'\n]*)["'][^)\n]*\)`)
+	widgetNameBefore  = regexp.MustCompile(`\bdbutils\.widgets\.(?:get|getArgument)\(\s*(?:name\s*=\s*)?["']([^"'\n]*)$`)
+)
+
+// widget is a widget declared in a notebook.
+type widget struct {
+	name         string
+	kind         string
+	defaultValue string
+}
+
+// widgetUse is a dbutils.widgets.get call and where the widget name and the
+// whole call sit in the cell text.
+type widgetUse struct {
+	name      string
+	nameStart int
+	nameEnd   int
+	callEnd   int
+}
+
+func (s *State) InlayHints(id int, uri string, visible lsp.Range, logger *log.Logger) *lsp.InlayHintResponse {
+
+	hints := []lsp.InlayHint{}
+
+	doc := s.Documents[uri]
+	if isNotebook(doc) {
+		widgets := findWidgets(doc)
+
+		for _, c := range splitIntoCells(doc) {
+			for _, use := range findWidgetUses(c) {
+				w, declared := widgets[use.name]
+				position := c.sourcePosition(c.lines, use.callEnd)
+				if !declared || position.Line < visible.StartPosition.Line || position.Line > visible.EndPosition.Line {
+					continue
+				}
+
+				hints = append(hints, lsp.InlayHint{
+					Position:    position,
+					Label:       fmt.Sprintf("= %q", w.defaultValue),
+					Tooltip:     fmt.Sprintf("Default value of the %s widget %s", w.kind, w.name),
+					PaddingLeft: true,
+				})
+			}
+		}
+	}
+	logger.Printf("Found %d widget hints", len(hints))
+
+	response := lsp.InlayHintResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: hints,
+	}
+
+	return &response
+}
+
+// findWidgets indexes the widgets declared in the Python cells of a notebook
+// by name. The first declaration of a name wins, as Databricks ignores later
+// ones.
+func findWidgets(doc string) map[string]widget {
+	widgets := map[string]widget{}
+
+	for _, c := range splitIntoCells(doc) {
+		if c.language != "python" {
+			continue
+		}
+		text := strings.Join(c.lines, "\n")
+
+		for _, match := range widgetDeclaration.FindAllStringSubmatchIndex(text, -1) {
+			if inPythonComment(text, match[0]) {
+				continue
+			}
+
+			name := text[match[4]:match[5]]
+			if _, found := widgets[name]; found {
+				continue
+			}
+			widgets[name] = widget{
+				name:         name,
+				kind:         text[match[2]:match[3]],
+				defaultValue: text[match[6]:match[7]],
+			}
+		}
+	}
+
+	return widgets
+}
+
+func findWidgetUses(c cell) []widgetUse {
+	var uses []widgetUse
+
+	if c.language != "python" {
+		return uses
+	}
+	text := strings.Join(c.lines, "\n")
+
+	for _, match := range widgetRead.FindAllStringSubmatchIndex(text, -1) {
+		if inPythonComment(text, match[0]) {
+			continue
+		}
+		uses = append(uses, widgetUse{
+			name:      text[match[2]:match[3]],
+			nameStart: match[2],
+			nameEnd:   match[3],
+			callEnd:   match[1],
+		})
+	}
+
+	return uses
+}
+
+// inPythonComment reports whether an offset of the text follows the "#" that
+// starts the comment of its line. A "#" inside a string starts no comment.
+func inPythonComment(text string, offset int) bool {
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	return pythonCommentStart(text[lineStart:offset]) >= 0
+}
+
+// widgetMessages warns about widgets that are read but never declared.
+func widgetMessages(doc string) []errorMessage {
+	var messages []errorMessage
+	widgets := findWidgets(doc)
+
+	for _, c := range splitIntoCells(doc) {
+		for _, use := range findWidgetUses(c) {
+			if _, declared := widgets[use.name]; declared {
+				continue
+			}
+
+			start := c.sourcePosition(c.lines, use.nameStart)
+			end := c.sourcePosition(c.lines, use.nameEnd)
+			messages = append(messages, errorMessage{
+				line:     start.Line + 1,
+				char:     start.Character + 1,
+				endLine:  end.Line + 1,
+				endChar:  end.Character + 1,
+				code:     "undeclared-widget",
+				desc:     fmt.Sprintf("Widget `%s` is not declared in this notebook", use.name),
+				source:   "dbutils",
+				severity: 2,
+			})
+		}
+	}
+
+	return messages
+}
+
+// widgetCompletionItems offers the declared widget names inside the string
+// passed to dbutils.widgets.get. It reports false outside of such a string.
+func widgetCompletionItems(doc, textBefore string) ([]lsp.CompletionItem, bool) {
+	if !widgetNameBefore.MatchString(textBefore) {
+		return nil, false
+	}
+
+	items := []lsp.CompletionItem{}
+	for _, w := range findWidgets(doc) {
+		items = append(items, lsp.CompletionItem{
+			Label:  w.name,
+			Kind:   lsp.CompletionItemKindVariable,
+			Detail: fmt.Sprintf("%s widget, default %q", w.kind, w.defaultValue),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+
+	return items, true
+}
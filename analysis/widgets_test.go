@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"testing"
+)
+
+const widgetNotebook = `# Databricks notebook source
+dbutils.widgets.text("env", "dev", "Environment")
+dbutils.widgets.dropdown(name="region", defaultValue="eu", choices=["eu", "us"])
+
+# COMMAND ----------
+
+env = dbutils.widgets.get("env")
+region = dbutils.widgets.get("regoin")
+run = dbutils.widgets.get("`
+
+func TestWidgetMessagesAndHints(t *testing.T) {
+	messages := widgetMessages(widgetNotebook)
+	if len(messages) != 1 || messages[0].line != 8 || messages[0].char != 31 || messages[0].endChar != 37 {
+		t.Fatalf("Expected regoin to be undeclared, Got: %+v", messages)
+	}
+
+	state := NewState()
+	state.OpenDocument("file:///nb.py", widgetNotebook)
+	visible := lsp.Range{EndPosition: lsp.Position{Line: 8}}
+
+	hints := state.InlayHints(1, "file:///nb.py", visible, log.New(os.Stderr, "", 0)).Result
+	if len(hints) != 1 || hints[0].Label != `= "dev"` || hints[0].Position != (lsp.Position{Line: 6, Character: 32}) {
+		t.Fatalf("Expected a hint after the env widget, Got: %+v", hints)
+	}
+}
+
+func TestWidgetNameCompletion(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///nb.py", widgetNotebook)
+
+	items := state.Completion(1, "file:///nb.py", lsp.Position{Line: 8, Character: 27}, log.New(os.Stderr, "", 0)).Result
+	if len(items) != 2 || items[0].Label != "env" || items[1].Label != "region" {
+		t.Fatalf("Expected the declared widgets, Got: %+v", items)
+	}
+}
+
+func TestWidgetsAfterHashInString(t *testing.T) {
+	doc := `# Databricks notebook source
+dbutils.widgets.text("a", "#1")
+print("#", dbutils.widgets.get("run_date"))  # dbutils.widgets.get("commented")`
+
+	if widgets := findWidgets(doc); len(widgets) != 1 {
+		t.Fatalf("Expected the widget declared after a # in a string, Got: %+v", widgets)
+	}
+	messages := widgetMessages(doc)
+	if len(messages) != 1 || messages[0].line != 3 || messages[0].char != 33 {
+		t.Fatalf("Expected run_date to be undeclared and the comment ignored, Got: %+v", messages)
+	}
+}
@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"bufio"
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// notebookExtension is the extension of Python notebook source files, the
+// only notebooks the server reads.
+const notebookExtension = ".py"
+
+// workspaceIndex holds the notebooks saved under the workspace root, by URI.
+// It is filled in the background and kept current from watched file events,
+// so it is guarded by a lock. Each scan takes the next generation, and a scan
+// that is overtaken by a newer one stops without replacing the index. File
+// updates made while a scan runs are kept in pending, nil for a removed file,
+// and applied again once the scan's results are in place.
+type workspaceIndex struct {
+	mu         sync.RWMutex
+	notebooks  map[string]indexedNotebook
+	generation int
+	pending    map[string]*indexedNotebook
+}
+
+// indexedNotebook is the saved content of a notebook.
+type indexedNotebook struct {
+	content string
+}
+
+// parsedNotebook is what the workspace features need from a version of a
+// notebook, kept until its content changes.
+type parsedNotebook struct {
+	uri     string
+	content string
+	tables  []tableDefinition
+	symbols []lsp.SymbolInformation
+}
+
+func newWorkspaceIndex() *workspaceIndex {
+	return &workspaceIndex{notebooks: map[string]indexedNotebook{}}
+}
+
+// IndexWorkspace indexes the notebooks under the workspace root in the
+// background.
+func (s *State) IndexWorkspace(logger *log.Logger) {
+	root := s.WorkspaceRoot
+	if root == "" {
+		return
+	}
+
+	go func() {
+		if count, done := s.index.scan(root); done {
+			logger.Printf("Indexed %d notebooks in %s", count, root)
+		} else {
+			logger.Printf("Indexing of %s was overtaken by a newer scan", root)
+		}
+	}()
+}
+
+// scan replaces the index with the notebooks found under the root, skipping
+// what the .gitignore files ignore. It reports false, leaving the index to the
+// newer scan, when another scan starts before it is done.
+func (index *workspaceIndex) scan(root string) (int, bool) {
+	generation := index.startScan()
+
+	current := func() bool {
+		index.mu.RLock()
+		defer index.mu.RUnlock()
+		return index.generation == generation
+	}
+
+	notebooks := map[string]indexedNotebook{}
+
+	var walk func(rel string, rules []gitignoreRule)
+	walk = func(rel string, rules []gitignoreRule) {
+		if !current() {
+			return
+		}
+		rules = append(rules[:len(rules):len(rules)], readGitignore(root, rel)...)
+
+		entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			child := path.Join(rel, entry.Name())
+			if entry.IsDir() {
+				if !skippedFolder(entry.Name()) && !gitignored(rules, child, true) {
+					walk(child, rules)
+				}
+				continue
+			}
+			if gitignored(rules, child, false) {
+				continue
+			}
+
+			fullPath := filepath.Join(root, filepath.FromSlash(child))
+			if notebook, ok := readNotebook(fullPath); ok {
+				notebooks[pathToURI(fullPath)] = notebook
+			}
+		}
+	}
+	walk("", nil)
+
+	if !index.finishScan(generation, notebooks) {
+		return 0, false
+	}
+	return len(notebooks), true
+}
+
+// startScan starts a new generation, overtaking any running scan.
+func (index *workspaceIndex) startScan() int {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.generation++
+	index.pending = map[string]*indexedNotebook{}
+	return index.generation
+}
+
+// finishScan puts the notebooks of a scan in place, with the updates made
+// while it ran, unless a newer scan has started since.
+func (index *workspaceIndex) finishScan(generation int, notebooks map[string]indexedNotebook) bool {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.generation != generation {
+		return false
+	}
+
+	for uri, notebook := range index.pending {
+		if notebook != nil {
+			notebooks[uri] = *notebook
+		} else {
+			delete(notebooks, uri)
+		}
+	}
+	index.notebooks = notebooks
+	index.pending = nil
+	return true
+}
+
+// update sets or, when notebook is nil, removes one file of the index. The
+// change is also kept for a scan that is running, which may have read the
+// file before it changed.
+func (index *workspaceIndex) update(uri string, notebook *indexedNotebook) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if notebook != nil {
+		index.notebooks[uri] = *notebook
+	} else {
+		delete(index.notebooks, uri)
+	}
+	if index.pending != nil {
+		index.pending[uri] = notebook
+	}
+}
+
+// readNotebook reads a source file if its first line is the notebook header.
+func readNotebook(fullPath string) (indexedNotebook, bool) {
+	if filepath.Ext(fullPath) != notebookExtension {
+		return indexedNotebook{}, false
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return indexedNotebook{}, false
+	}
+	firstLine, _ := bufio.NewReader(file).ReadString('\n')
+	file.Close()
+	if !isNotebook(firstLine) {
+		return indexedNotebook{}, false
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return indexedNotebook{}, false
+	}
+	return indexedNotebook{content: string(content)}, true
+}
+
+// WatchedFilesChanged updates the index from the client's file events. A
+// changed .gitignore can hide or reveal any number of notebooks, so it
+// rescans the workspace.
+func (s *State) WatchedFilesChanged(changes []lsp.FileEvent, logger *log.Logger) {
+	if s.WorkspaceRoot == "" {
+		return
+	}
+
+	for _, change := range changes {
+		fullPath := uriToPath(change.URI)
+		if filepath.Base(fullPath) == ".gitignore" {
+			s.IndexWorkspace(logger)
+			return
+		}
+
+		rel, err := filepath.Rel(s.WorkspaceRoot, fullPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		uri := pathToURI(fullPath)
+
+		var indexed *indexedNotebook
+		if change.Type != lsp.FileChangeTypeDeleted {
+			rules, folderIgnored := ancestorGitignores(s.WorkspaceRoot, filepath.ToSlash(rel))
+			if !folderIgnored && !gitignored(rules, filepath.ToSlash(rel), false) {
+				if notebook, ok := readNotebook(fullPath); ok {
+					indexed = &notebook
+				}
+			}
+		}
+		s.index.update(uri, indexed)
+	}
+	logger.Printf("Updated the index for %d file changes", len(changes))
+}
+
+// indexedNotebooks returns a copy of the index, for use without the lock.
+func (index *workspaceIndex) indexedNotebooks() map[string]indexedNotebook {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	notebooks := make(map[string]indexedNotebook, len(index.notebooks))
+	for uri, notebook := range index.notebooks {
+		notebooks[uri] = notebook
+	}
+	return notebooks
+}
+
+func (index *workspaceIndex) notebook(uri string) (indexedNotebook, bool) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	notebook, found := index.notebooks[uri]
+	return notebook, found
+}
+
+// workspaceNotebooks returns the open notebooks and the indexed ones, the open
+// version of a document taking the place of the saved one.
+func (s *State) workspaceNotebooks() map[string]string {
+	notebooks := map[string]string{}
+	for uri, notebook := range s.index.indexedNotebooks() {
+		notebooks[uri] = notebook.content
+	}
+	for uri, doc := range s.Documents {
+		if isNotebook(doc) {
+			notebooks[uri] = doc
+		}
+	}
+	return notebooks
+}
+
+// parsedNotebooks parses every notebook in the workspace, reusing the results
+// for notebooks that have not changed. They are ordered by URI.
+func (s *State) parsedNotebooks() []parsedNotebook {
+	if s.parsed == nil {
+		s.parsed = map[string]parsedNotebook{}
+	}
+
+	notebooks := s.workspaceNotebooks()
+	uris := make([]string, 0, len(notebooks))
+	for uri := range notebooks {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	var parsed []parsedNotebook
+	for _, uri := range uris {
+		notebook, found := s.parsed[uri]
+		if !found || notebook.content != notebooks[uri] {
+			notebook = parsedNotebook{
+				uri:     uri,
+				content: notebooks[uri],
+				tables:  findTableDefinitions(uri, notebooks[uri]),
+				symbols: s.notebookSymbols(uri, notebooks[uri]),
+			}
+			s.parsed[uri] = notebook
+		}
+		parsed = append(parsed, notebook)
+	}
+
+	for uri := range s.parsed {
+		if _, found := notebooks[uri]; !found {
+			delete(s.parsed, uri)
+		}
+	}
+
+	return parsed
+}
@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGitignored(t *testing.T) {
+	rules := parseGitignore("", "# build output\n/build/\n*.tmp.py\n!keep.tmp.py\ndocs/**/draft_*\n")
+	rules = append(rules, parseGitignore("jobs", "scratch\n")...)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"build", true, true},
+		{"src/build", true, false},
+		{"build", false, false},
+		{"etl/load.tmp.py", false, true},
+		{"etl/keep.tmp.py", false, false},
+		{"docs/a/b/draft_x.py", false, true},
+		{"docs/final.py", false, false},
+		{"jobs/nightly/scratch", false, true},
+		{"scratch", false, false},
+	}
+	for _, test := range tests {
+		if got := gitignored(rules, test.path, test.isDir); got != test.ignored {
+			t.Fatalf("Expected ignored=%v for %s, Got: %v", test.ignored, test.path, got)
+		}
+	}
+}
+
+func TestGitignoreMalformedPatterns(t *testing.T) {
+	rules := parseGitignore("", "[z-a].py\n[]x].py\na[!]b\n*.tmp.py\n")
+	if len(rules) != 1 {
+		t.Fatalf("Expected only the valid rule, Got: %+v", rules)
+	}
+	if !gitignored(rules, "load.tmp.py", false) || gitignored(rules, "z.py", false) {
+		t.Fatal("Expected the valid rule to apply and the malformed ones to be skipped")
+	}
+}
+
+func TestWorkspaceIndex(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":           "out/\n",
+		"etl/load.py":          "# Databricks notebook source\nx = 1\n",
+		"etl/report.sql":       "-- Databricks notebook source\nSELECT 1\n",
+		"etl/helpers.py":       "def helper():\n    pass\n",
+		"out/copy.py":          "# Databricks notebook source\n",
+		".venv/lib/module.py":  "# Databricks notebook source\n",
+		"jobs/.gitignore":      "*.py\n!nightly.py\n",
+		"jobs/nightly.py":      "# Databricks notebook source\n",
+		"jobs/experimental.py": "# Databricks notebook source\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := NewState()
+	state.WorkspaceRoot = root
+	state.index.scan(root)
+
+	indexed := func() string {
+		var names []string
+		for uri := range state.index.indexedNotebooks() {
+			rel, _ := filepath.Rel(root, uriToPath(uri))
+			names = append(names, filepath.ToSlash(rel))
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+	if got := indexed(); got != "etl/load.py,jobs/nightly.py" {
+		t.Fatalf("Expected the notebooks outside ignored paths, Got: %s", got)
+	}
+
+	os.WriteFile(filepath.Join(root, "etl/helpers.py"), []byte("# Databricks notebook source\n"), 0644)
+	os.WriteFile(filepath.Join(root, "jobs/weekly.py"), []byte("# Databricks notebook source\n"), 0644)
+	os.Remove(filepath.Join(root, "etl/load.py"))
+	state.WatchedFilesChanged([]lsp.FileEvent{
+		{URI: pathToURI(filepath.Join(root, "etl/helpers.py")), Type: lsp.FileChangeTypeChanged},
+		{URI: pathToURI(filepath.Join(root, "jobs/weekly.py")), Type: lsp.FileChangeTypeCreated},
+		{URI: pathToURI(filepath.Join(root, "etl/load.py")), Type: lsp.FileChangeTypeDeleted},
+	}, log.New(os.Stderr, "", 0))
+
+	if got := indexed(); got != "etl/helpers.py,jobs/nightly.py" {
+		t.Fatalf("Expected the index to follow the file changes, Got: %s", got)
+	}
+}
+
+func TestWorkspaceIndexScanGenerations(t *testing.T) {
+	index := newWorkspaceIndex()
+	notebook := indexedNotebook{content: "# Databricks notebook source\n"}
+
+	older := index.startScan()
+	newer := index.startScan()
+	index.update("file:///added.py", &notebook)
+	index.update("file:///removed.py", nil)
+
+	if index.finishScan(older, map[string]indexedNotebook{"file:///stale.py": notebook}) {
+		t.Fatal("Expected the overtaken scan to leave the index alone")
+	}
+	if !index.finishScan(newer, map[string]indexedNotebook{"file:///removed.py": notebook, "file:///kept.py": notebook}) {
+		t.Fatal("Expected the newest scan to replace the index")
+	}
+
+	var uris []string
+	for uri := range index.indexedNotebooks() {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	if strings.Join(uris, " ") != "file:///added.py file:///kept.py" {
+		t.Fatalf("Expected the scan with the updates made during it, Got: %v", uris)
+	}
+}
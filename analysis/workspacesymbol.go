@@ -0,0 +1,170 @@
+package analysis
+
+import (
+	"log"
+	"myfirstlsp/lsp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// workspaceSymbolLimit caps how many symbols a search returns.
+const workspaceSymbolLimit = 200
+
+type scoredSymbol struct {
+	symbol lsp.SymbolInformation
+	score  int
+}
+
+// WorkspaceSymbols searches the Python functions and classes, created tables
+// and views, cell titles and widgets of every notebook in the workspace. The
+// query matches fuzzily, best matches first.
+func (s *State) WorkspaceSymbols(id int, query string, logger *log.Logger) *lsp.WorkspaceSymbolResponse {
+
+	var matches []scoredSymbol
+	for _, notebook := range s.parsedNotebooks() {
+		for _, symbol := range notebook.symbols {
+			if score, ok := fuzzyScore(query, symbol.Name); ok {
+				matches = append(matches, scoredSymbol{symbol: symbol, score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].symbol.Name < matches[j].symbol.Name
+	})
+	logger.Printf("Found %d workspace symbols for %q", len(matches), query)
+
+	symbols := []lsp.SymbolInformation{}
+	for _, match := range matches[:min(len(matches), workspaceSymbolLimit)] {
+		symbols = append(symbols, match.symbol)
+	}
+
+	response := lsp.WorkspaceSymbolResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: symbols,
+	}
+
+	return &response
+}
+
+// notebookSymbols lists the symbols of a notebook that are searched across the
+// workspace, each placed in the notebook's path.
+func (s *State) notebookSymbols(uri, doc string) []lsp.SymbolInformation {
+	var symbols []lsp.SymbolInformation
+
+	if !isNotebook(doc) {
+		return symbols
+	}
+	container := s.relativePath(uri)
+
+	add := func(name string, kind int, r lsp.Range) {
+		symbols = append(symbols, lsp.SymbolInformation{
+			Name:          name,
+			Kind:          kind,
+			Location:      lsp.Location{URI: uri, Range: r},
+			ContainerName: container,
+		})
+	}
+
+	var addPython func(children []lsp.DocumentSymbol)
+	addPython = func(children []lsp.DocumentSymbol) {
+		for _, child := range children {
+			add(child.Name, child.Kind, child.SelectionRange)
+			addPython(child.Children)
+		}
+	}
+
+	for _, c := range splitIntoCells(doc) {
+		if c.title != "" {
+			for i, line := range c.lines {
+				if isTitleLine(line) {
+					add(c.title, lsp.SymbolKindModule, lineRange(c.lines, c.startLine, c.startLine+i, c.startLine+i))
+					break
+				}
+			}
+		}
+
+		if c.language == "python" {
+			addPython(pythonSymbols(c))
+
+			text := strings.Join(c.lines, "\n")
+			for _, match := range widgetDeclaration.FindAllStringSubmatchIndex(text, -1) {
+				if !inPythonComment(text, match[0]) {
+					add(text[match[4]:match[5]], lsp.SymbolKindVariable, lsp.Range{
+						StartPosition: c.sourcePosition(c.lines, match[4]),
+						EndPosition:   c.sourcePosition(c.lines, match[5]),
+					})
+				}
+			}
+		}
+	}
+
+	for _, definition := range findTableDefinitions(uri, doc) {
+		add(definition.name, lsp.SymbolKindStruct, definition.nameRange)
+	}
+
+	return symbols
+}
+
+// fuzzyScore matches the letters of a query, in order, against a name. Matches
+// score higher when they start the name or a word in it, run on from the
+// previous letter, or hold the whole query together. Spaces in the query are
+// ignored and an empty query matches everything. Letters are compared a rune
+// at a time, as lower casing can change the length of a string.
+func fuzzyScore(query, name string) (int, bool) {
+	wanted := lowerRunes(strings.ReplaceAll(query, " ", ""))
+	if len(wanted) == 0 {
+		return 0, true
+	}
+
+	runes := []rune(name)
+	lower := lowerRunes(name)
+
+	score, last := 0, -2
+	next := 0
+	for i := 0; i < len(lower) && next < len(wanted); i++ {
+		if lower[i] != wanted[next] {
+			continue
+		}
+
+		score++
+		switch {
+		case i == 0:
+			score += 8
+		case !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]),
+			unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]):
+			score += 6
+		}
+		if i == last+1 {
+			score += 4
+		}
+		last = i
+		next++
+	}
+	if next < len(wanted) {
+		return 0, false
+	}
+
+	if strings.Contains(string(lower), string(wanted)) {
+		score += 10
+	}
+	if string(lower) == string(wanted) {
+		score += 20
+	}
+	return score, true
+}
+
+func lowerRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
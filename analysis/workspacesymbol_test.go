@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"io"
+	"log"
+	"myfirstlsp/lsp"
+	"testing"
+)
+
+const symbolsNotebook = `# Databricks notebook source
+# DBTITLE 1,Load orders
+dbutils.widgets.text("run_date", "")
+
+def load_orders(path):
+    return spark.read.json(path)
+
+# COMMAND ----------
+
+# MAGIC %sql
+# MAGIC CREATE OR REPLACE TEMP VIEW order_totals AS SELECT 1
+`
+
+func TestWorkspaceSymbols(t *testing.T) {
+	state := NewState()
+	state.OpenDocument("file:///pipeline.py", symbolsNotebook)
+	logger := log.New(io.Discard, "", 0)
+
+	expected := map[string]int{
+		"Load orders":  lsp.SymbolKindModule,
+		"run_date":     lsp.SymbolKindVariable,
+		"load_orders":  lsp.SymbolKindFunction,
+		"order_totals": lsp.SymbolKindStruct,
+	}
+	all := state.WorkspaceSymbols(1, "", logger).Result
+	if len(all) != len(expected) {
+		t.Fatalf("Expected %d symbols, Got: %+v", len(expected), all)
+	}
+	for _, symbol := range all {
+		if kind, ok := expected[symbol.Name]; !ok || kind != symbol.Kind || symbol.ContainerName == "" {
+			t.Errorf("Unexpected symbol: %+v", symbol)
+		}
+	}
+
+	found := state.WorkspaceSymbols(1, "load_o", logger).Result
+	if len(found) != 1 || found[0].Name != "load_orders" {
+		t.Fatalf("Expected load_orders, Got: %+v", found)
+	}
+	if found[0].Location.Range.StartPosition != (lsp.Position{Line: 4, Character: 4}) {
+		t.Errorf("Expected load_orders at 4:4, Got: %+v", found[0].Location.Range)
+	}
+
+	if found := state.WorkspaceSymbols(1, "zzz", logger).Result; found == nil || len(found) != 0 {
+		t.Errorf("Expected an empty result, Got: %#v", found)
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("otl", "order_totals"); !ok {
+		t.Error("Expected otl to match order_totals")
+	}
+	if _, ok := fuzzyScore("lto", "order_totals"); ok {
+		t.Error("Expected lto not to match order_totals")
+	}
+
+	prefix, _ := fuzzyScore("ord", "order_totals")
+	inner, _ := fuzzyScore("ord", "reorder")
+	if prefix <= inner {
+		t.Errorf("Expected a prefix match to score higher, Got: %d and %d", prefix, inner)
+	}
+
+	if _, ok := fuzzyScore("x", "ȺȺx"); !ok {
+		t.Error("Expected x to match a name whose lower case is longer")
+	}
+	if _, ok := fuzzyScore("ⱥx", "ȺȺx"); !ok {
+		t.Error("Expected a lower case query to match upper case letters")
+	}
+}
@@ -6,10 +6,58 @@ type InitialiseRequest struct {
 }
 
 type InitialiseRequestParams struct {
-	ClientInfo *ClientInfo `json:"clientInfo"`
+	ClientInfo       *ClientInfo        `json:"clientInfo"`
+	RootURI          string             `json:"rootUri"`
+	WorkspaceFolders []WorkspaceFolder  `json:"workspaceFolders"`
+	Capabilities     ClientCapabilities `json:"capabilities"`
+
+	InitializationOptions InitializationOptions `json:"initializationOptions"`
 	// ..... More to add here!
 }
 
+// InitializationOptions are the server's own settings, sent by the client.
+// Linters switches lint backends on or off by name: ruff and mypy run unless
+// switched off, and sqlfluff only runs when switched on. CatalogFile is the
+// local schema description, relative to the workspace root.
+type InitializationOptions struct {
+	SQLFormat   SQLFormatOptions `json:"sqlFormat"`
+	Linters     map[string]bool  `json:"linters"`
+	CatalogFile string           `json:"catalogFile"`
+}
+
+// SQLFormatOptions configure the SQL formatter. KeywordCase is "upper" or
+// "lower", and an IndentWidth of 0 uses the editor's tab size.
+type SQLFormatOptions struct {
+	KeywordCase string `json:"keywordCase"`
+	IndentWidth int    `json:"indentWidth"`
+}
+
+// ClientCapabilities holds the parts of the client's capabilities the server
+// acts on.
+type ClientCapabilities struct {
+	Workspace    WorkspaceClientCapabilities    `json:"workspace"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument"`
+}
+
+// TextDocumentClientCapabilities holds Diagnostic only when the client pulls
+// diagnostics.
+type TextDocumentClientCapabilities struct {
+	Diagnostic *DynamicRegistrationCapability `json:"diagnostic"`
+}
+
+type WorkspaceClientCapabilities struct {
+	DidChangeWatchedFiles DynamicRegistrationCapability `json:"didChangeWatchedFiles"`
+}
+
+type DynamicRegistrationCapability struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+}
+
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
 type ClientInfo struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
@@ -26,9 +74,23 @@ type InitialiseResult struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync       int                  `json:"textDocumentSync"`
-	HoverProvider          bool                 `json:"hoverProvider"`
-	SemanticTokensProvider SematicTokensOptions `json:"semanticTokensProvider"`
+	TextDocumentSync                int                  `json:"textDocumentSync"`
+	HoverProvider                   bool                 `json:"hoverProvider"`
+	SemanticTokensProvider          SematicTokensOptions `json:"semanticTokensProvider"`
+	CompletionProvider              CompletionOptions    `json:"completionProvider"`
+	SignatureHelpProvider           SignatureHelpOptions `json:"signatureHelpProvider"`
+	DocumentSymbolProvider          bool                 `json:"documentSymbolProvider"`
+	FoldingRangeProvider            bool                 `json:"foldingRangeProvider"`
+	DefinitionProvider              bool                 `json:"definitionProvider"`
+	DocumentLinkProvider            DocumentLinkOptions  `json:"documentLinkProvider"`
+	InlayHintProvider               bool                 `json:"inlayHintProvider"`
+	CodeActionProvider              CodeActionOptions    `json:"codeActionProvider"`
+	DocumentFormattingProvider      bool                 `json:"documentFormattingProvider"`
+	DocumentRangeFormattingProvider bool                 `json:"documentRangeFormattingProvider"`
+	WorkspaceSymbolProvider         bool                 `json:"workspaceSymbolProvider"`
+	ReferencesProvider              bool                 `json:"referencesProvider"`
+	RenameProvider                  bool                 `json:"renameProvider"`
+	DiagnosticProvider              DiagnosticOptions    `json:"diagnosticProvider"`
 }
 
 type ServerInfo struct {
@@ -48,11 +110,38 @@ func NewInitialiseResponse(id int) InitialiseResponse {
 				HoverProvider:    true,
 				SemanticTokensProvider: SematicTokensOptions{
 					Legend: SemanticTokensLegend{
-						TokenTypes:     []string{"namespace", "property", "method", "string"},
+						TokenTypes:     SemanticTokenTypes,
 						TokenModifiers: []string{},
 					},
 					Full: true,
 				},
+				CompletionProvider: CompletionOptions{
+					TriggerCharacters: []string{"#", ".", "\"", "'"},
+				},
+				SignatureHelpProvider: SignatureHelpOptions{
+					TriggerCharacters: []string{"(", ","},
+				},
+				DocumentSymbolProvider: true,
+				FoldingRangeProvider:   true,
+				DefinitionProvider:     true,
+				DocumentLinkProvider:   DocumentLinkOptions{},
+				InlayHintProvider:      true,
+				CodeActionProvider: CodeActionOptions{
+					CodeActionKinds: []string{
+						CodeActionKindQuickFix,
+						CodeActionKindSourceFixAll,
+						CodeActionKindSourceOrganizeImports,
+					},
+				},
+				DocumentFormattingProvider:      true,
+				DocumentRangeFormattingProvider: true,
+				WorkspaceSymbolProvider:         true,
+				ReferencesProvider:              true,
+				RenameProvider:                  true,
+				DiagnosticProvider: DiagnosticOptions{
+					InterFileDependencies: true,
+					WorkspaceDiagnostics:  true,
+				},
 			},
 			ServerInfo: ServerInfo{
 				Name:    "myfirstlsp",
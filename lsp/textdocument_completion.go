@@ -0,0 +1,43 @@
+package lsp
+
+const (
+	CompletionItemKindMethod   = 2
+	CompletionItemKindFunction = 3
+	CompletionItemKindField    = 5
+	CompletionItemKindVariable = 6
+	CompletionItemKindModule   = 9
+	CompletionItemKindKeyword  = 14
+	CompletionItemKindStruct   = 22
+)
+
+const (
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+)
+
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+type CompletionRequest struct {
+	Request
+	Params CompletionParams `json:"params"`
+}
+
+type CompletionParams struct {
+	TextDocumentPositionParams
+}
+
+type CompletionResponse struct {
+	Response
+	Result []CompletionItem `json:"result"`
+}
+
+type CompletionItem struct {
+	Label            string `json:"label"`
+	Kind             int    `json:"kind,omitempty"`
+	Detail           string `json:"detail,omitempty"`
+	Documentation    string `json:"documentation,omitempty"`
+	InsertText       string `json:"insertText,omitempty"`
+	InsertTextFormat int    `json:"insertTextFormat,omitempty"`
+}
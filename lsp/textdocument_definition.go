@@ -0,0 +1,20 @@
+package lsp
+
+type DefinitionRequest struct {
+	Request
+	Params DefinitionParams `json:"params"`
+}
+
+type DefinitionParams struct {
+	TextDocumentPositionParams
+}
+
+type DefinitionResponse struct {
+	Response
+	Result *Location `json:"result"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
@@ -0,0 +1,41 @@
+package lsp
+
+const (
+	DocumentDiagnosticReportKindFull      = "full"
+	DocumentDiagnosticReportKindUnchanged = "unchanged"
+)
+
+type DiagnosticOptions struct {
+	InterFileDependencies bool `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool `json:"workspaceDiagnostics"`
+}
+
+type DocumentDiagnosticRequest struct {
+	Request
+	Params DocumentDiagnosticParams `json:"params"`
+}
+
+type DocumentDiagnosticParams struct {
+	TextDocument     TextDocumentIdentifier `json:"textDocument"`
+	PreviousResultID string                 `json:"previousResultId,omitempty"`
+}
+
+// DocumentDiagnosticResponse holds a FullDocumentDiagnosticReport or an
+// UnchangedDocumentDiagnosticReport.
+type DocumentDiagnosticResponse struct {
+	Response
+	Result any `json:"result"`
+}
+
+type FullDocumentDiagnosticReport struct {
+	Kind     string       `json:"kind"`
+	ResultID string       `json:"resultId"`
+	Items    []Diagnostic `json:"items"`
+}
+
+// UnchangedDocumentDiagnosticReport tells the client that the diagnostics it
+// holds under the result ID still stand.
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     string `json:"kind"`
+	ResultID string `json:"resultId"`
+}
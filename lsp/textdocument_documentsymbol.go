@@ -0,0 +1,34 @@
+package lsp
+
+const (
+	SymbolKindModule   = 2
+	SymbolKindClass    = 5
+	SymbolKindMethod   = 6
+	SymbolKindFunction = 12
+	SymbolKindVariable = 13
+	SymbolKindString   = 15
+	SymbolKindStruct   = 23
+)
+
+type DocumentSymbolRequest struct {
+	Request
+	Params DocumentSymbolParams `json:"params"`
+}
+
+type DocumentSymbolParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentSymbolResponse struct {
+	Response
+	Result []DocumentSymbol `json:"result"`
+}
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
@@ -0,0 +1,26 @@
+package lsp
+
+const (
+	FoldingRangeKindComment = "comment"
+	FoldingRangeKindRegion  = "region"
+)
+
+type FoldingRangeRequest struct {
+	Request
+	Params FoldingRangeParams `json:"params"`
+}
+
+type FoldingRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type FoldingRangeResponse struct {
+	Response
+	Result []FoldingRange `json:"result"`
+}
+
+type FoldingRange struct {
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Kind      string `json:"kind,omitempty"`
+}
@@ -0,0 +1,32 @@
+package lsp
+
+type DocumentFormattingRequest struct {
+	Request
+	Params DocumentFormattingParams `json:"params"`
+}
+
+type DocumentFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+type DocumentRangeFormattingRequest struct {
+	Request
+	Params DocumentRangeFormattingParams `json:"params"`
+}
+
+type DocumentRangeFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+type FormattingOptions struct {
+	TabSize      int  `json:"tabSize"`
+	InsertSpaces bool `json:"insertSpaces"`
+}
+
+type DocumentFormattingResponse struct {
+	Response
+	Result []TextEdit `json:"result"`
+}
@@ -11,9 +11,19 @@ type HoverParams struct {
 
 type HoverResponse struct {
 	Response
-	Result HoverResult `json:"result"`
+	Result *HoverResult `json:"result"`
 }
 
 type HoverResult struct {
-	Contents string `json:"contents"`
+	Contents MarkupContent `json:"contents"`
+}
+
+const (
+	MarkupKindPlainText = "plaintext"
+	MarkupKindMarkdown  = "markdown"
+)
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
 }
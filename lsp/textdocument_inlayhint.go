@@ -0,0 +1,30 @@
+package lsp
+
+const (
+	InlayHintKindType      = 1
+	InlayHintKindParameter = 2
+)
+
+type InlayHintRequest struct {
+	Request
+	Params InlayHintParams `json:"params"`
+}
+
+type InlayHintParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+}
+
+type InlayHintResponse struct {
+	Response
+	Result []InlayHint `json:"result"`
+}
+
+type InlayHint struct {
+	Position     Position `json:"position"`
+	Label        string   `json:"label"`
+	Kind         int      `json:"kind,omitempty"`
+	Tooltip      string   `json:"tooltip,omitempty"`
+	PaddingLeft  bool     `json:"paddingLeft,omitempty"`
+	PaddingRight bool     `json:"paddingRight,omitempty"`
+}
@@ -6,11 +6,16 @@ type PublishDiagnosticParams struct {
 }
 
 type Diagnostic struct {
-	Range    Range  `json:"range"`
-	Severity int    `json:"severity"`
-	Code     string `json:"code"`
-	Source   string `json:"source"`
-	Message  string `json:"message"`
+	Range           Range            `json:"range"`
+	Severity        int              `json:"severity"`
+	Code            string           `json:"code"`
+	CodeDescription *CodeDescription `json:"codeDescription,omitempty"`
+	Source          string           `json:"source"`
+	Message         string           `json:"message"`
+}
+
+type CodeDescription struct {
+	Href string `json:"href"`
 }
 
 type Range struct {
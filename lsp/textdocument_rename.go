@@ -0,0 +1,16 @@
+package lsp
+
+type RenameRequest struct {
+	Request
+	Params RenameParams `json:"params"`
+}
+
+type RenameParams struct {
+	TextDocumentPositionParams
+	NewName string `json:"newName"`
+}
+
+type RenameResponse struct {
+	Response
+	Result *WorkspaceEdit `json:"result"`
+}
@@ -23,3 +23,38 @@ type SemanticTokenResponse struct {
 type SemanticTokenResult struct {
 	Data []uint `json:"data"`
 }
+
+// Semantic token types, in the order they are advertised in the legend.
+const (
+	TokenNamespace = iota
+	TokenProperty
+	TokenMethod
+	TokenString
+	TokenComment
+	TokenDecorator
+	TokenKeyword
+	TokenVariable
+	TokenMacro
+	TokenParameter
+	TokenMarkdownHeading
+	TokenMarkdownEmphasis
+	TokenMarkdownLink
+	TokenMarkdownCode
+)
+
+var SemanticTokenTypes = []string{
+	"namespace",
+	"property",
+	"method",
+	"string",
+	"comment",
+	"decorator",
+	"keyword",
+	"variable",
+	"macro",
+	"parameter",
+	"markdownHeading",
+	"markdownEmphasis",
+	"markdownLink",
+	"markdownCode",
+}
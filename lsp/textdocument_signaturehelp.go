@@ -0,0 +1,35 @@
+package lsp
+
+type SignatureHelpOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+type SignatureHelpRequest struct {
+	Request
+	Params SignatureHelpParams `json:"params"`
+}
+
+type SignatureHelpParams struct {
+	TextDocumentPositionParams
+}
+
+type SignatureHelpResponse struct {
+	Response
+	Result *SignatureHelp `json:"result"`
+}
+
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature int                    `json:"activeSignature"`
+	ActiveParameter int                    `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation *MarkupContent         `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters"`
+}
+
+type ParameterInformation struct {
+	Label string `json:"label"`
+}
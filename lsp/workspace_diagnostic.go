@@ -0,0 +1,40 @@
+package lsp
+
+type WorkspaceDiagnosticRequest struct {
+	Request
+	Params WorkspaceDiagnosticParams `json:"params"`
+}
+
+type WorkspaceDiagnosticParams struct {
+	PreviousResultIDs []PreviousResultID `json:"previousResultIds"`
+}
+
+type PreviousResultID struct {
+	URI   string `json:"uri"`
+	Value string `json:"value"`
+}
+
+type WorkspaceDiagnosticResponse struct {
+	Response
+	Result WorkspaceDiagnosticReport `json:"result"`
+}
+
+// WorkspaceDiagnosticReport holds a WorkspaceFullDocumentDiagnosticReport or a
+// WorkspaceUnchangedDocumentDiagnosticReport for each document.
+type WorkspaceDiagnosticReport struct {
+	Items []any `json:"items"`
+}
+
+// WorkspaceFullDocumentDiagnosticReport is the full report of one document.
+// Version is nil for documents that are not open.
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
@@ -0,0 +1,70 @@
+package lsp
+
+const (
+	FileChangeTypeCreated = 1
+	FileChangeTypeChanged = 2
+	FileChangeTypeDeleted = 3
+)
+
+type DidChangeWatchedFilesNotification struct {
+	Notification
+	Params DidChangeWatchedFilesParams `json:"params"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
+
+type FileEvent struct {
+	URI  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+// RegistrationRequest is sent by the server to ask the client for a capability
+// it did not declare up front, such as file watching.
+type RegistrationRequest struct {
+	Request
+	Params RegistrationParams `json:"params"`
+}
+
+type RegistrationParams struct {
+	Registrations []Registration `json:"registrations"`
+}
+
+type Registration struct {
+	ID              string `json:"id"`
+	Method          string `json:"method"`
+	RegisterOptions any    `json:"registerOptions,omitempty"`
+}
+
+type DidChangeWatchedFilesRegistrationOptions struct {
+	Watchers []FileSystemWatcher `json:"watchers"`
+}
+
+type FileSystemWatcher struct {
+	GlobPattern string `json:"globPattern"`
+}
+
+// NewWatchedFilesRegistration asks the client to report changes to Python
+// sources and .gitignore files anywhere in the workspace.
+func NewWatchedFilesRegistration(id int) RegistrationRequest {
+	return RegistrationRequest{
+		Request: Request{
+			RPC:    "2.0",
+			ID:     id,
+			Method: "client/registerCapability",
+		},
+		Params: RegistrationParams{
+			Registrations: []Registration{{
+				ID:     "workspace/didChangeWatchedFiles",
+				Method: "workspace/didChangeWatchedFiles",
+				RegisterOptions: DidChangeWatchedFilesRegistrationOptions{
+					Watchers: []FileSystemWatcher{
+						{GlobPattern: "**/*.py"},
+						{GlobPattern: "**/.gitignore"},
+					},
+				},
+			}},
+		},
+	}
+}
@@ -38,7 +38,7 @@ func main() {
 			continue
 		}
 
-		handleMessage(logger, writer, state, method, contents)
+		handleMessage(logger, writer, &state, method, contents)
 	}
 }
 
@@ -51,7 +51,7 @@ func printError(logger *log.Logger) {
 	}
 }
 
-func handleMessage(logger *log.Logger, writer io.Writer, state analysis.State, method string, contents []byte) {
+func handleMessage(logger *log.Logger, writer io.Writer, state *analysis.State, method string, contents []byte) {
 	logger.Printf("recieved msg with method: %s", method)
 	switch method {
 	case "initialize":
@@ -68,12 +68,36 @@ func handleMessage(logger *log.Logger, writer io.Writer, state analysis.State, m
 			request.Params.ClientInfo.Name,
 			request.Params.ClientInfo.Version)
 
+		state.SetWorkspaceRoot(request.Params.RootURI, request.Params.WorkspaceFolders)
+		state.SQLFormat = request.Params.InitializationOptions.SQLFormat
+		state.Linters = request.Params.InitializationOptions.Linters
+		state.CatalogFile = request.Params.InitializationOptions.CatalogFile
+		logger.Printf("Workspace root: %s", state.WorkspaceRoot)
+		state.LoadCatalog(logger)
+		state.WatchFiles = request.Params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+		state.PullDiagnostics = request.Params.Capabilities.TextDocument.Diagnostic != nil
+		state.IndexWorkspace(logger)
+
 		//Reply:
 		msg := lsp.NewInitialiseResponse(request.ID)
 		writeResponse(writer, msg)
 
 		logger.Printf("sent reply")
 
+	case "initialized":
+		if state.WatchFiles {
+			writeResponse(writer, lsp.NewWatchedFilesRegistration(1))
+			logger.Printf("Registered file watchers")
+		}
+
+	case "workspace/didChangeWatchedFiles":
+		var request lsp.DidChangeWatchedFilesNotification
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("workspace/didChangeWatchedFiles %s", err)
+		}
+
+		state.WatchedFilesChanged(request.Params.Changes, logger)
+
 	case "textDocument/didOpen":
 		var request lsp.DidOpenTextDocumentNotification
 		if err := json.Unmarshal(contents, &request); err != nil {
@@ -91,8 +115,10 @@ func handleMessage(logger *log.Logger, writer io.Writer, state analysis.State, m
 			logger.Printf("Error Linting: %s", err)
 		}
 
-		response := state.PublishDiagnostics(request.Params.TextDocument.URI, logger)
-		writeResponse(writer, response)
+		if !state.PullDiagnostics {
+			response := state.PublishDiagnostics(request.Params.TextDocument.URI, logger)
+			writeResponse(writer, response)
+		}
 
 	case "textDocument/didChange":
 		var request lsp.DidChangeTextDocumentNotification
@@ -114,9 +140,11 @@ func handleMessage(logger *log.Logger, writer io.Writer, state analysis.State, m
 				logger.Printf("Error Linting: %s", err)
 			}
 
-			response := state.PublishDiagnostics(request.Params.TextDocument.URI, logger)
-			logger.Println("Published Diagnostics")
-			writeResponse(writer, response)
+			if !state.PullDiagnostics {
+				response := state.PublishDiagnostics(request.Params.TextDocument.URI, logger)
+				logger.Println("Published Diagnostics")
+				writeResponse(writer, response)
+			}
 
 		}
 
@@ -141,11 +169,143 @@ func handleMessage(logger *log.Logger, writer io.Writer, state analysis.State, m
 		// Create a response
 		response := state.Hover(request.ID, request.Params.TextDocument.URI, request.Params.Position, logger)
 		//Write it back:
+		writeResponse(writer, response)
 
-		if response != nil {
-			writeResponse(writer, response)
+	case "textDocument/completion":
+		var request lsp.CompletionRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/completion %s", err)
+		}
+
+		response := state.Completion(request.ID, request.Params.TextDocument.URI, request.Params.Position, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/signatureHelp":
+		var request lsp.SignatureHelpRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/signatureHelp %s", err)
+		}
+
+		response := state.SignatureHelp(request.ID, request.Params.TextDocument.URI, request.Params.Position, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/documentSymbol":
+		var request lsp.DocumentSymbolRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/documentSymbol %s", err)
+		}
+
+		response := state.DocumentSymbols(request.ID, request.Params.TextDocument.URI, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/foldingRange":
+		var request lsp.FoldingRangeRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/foldingRange %s", err)
+		}
+
+		response := state.FoldingRanges(request.ID, request.Params.TextDocument.URI, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/definition":
+		var request lsp.DefinitionRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/definition %s", err)
+		}
+
+		response := state.Definition(request.ID, request.Params.TextDocument.URI, request.Params.Position, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/documentLink":
+		var request lsp.DocumentLinkRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/documentLink %s", err)
+		}
+
+		response := state.DocumentLinks(request.ID, request.Params.TextDocument.URI, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/inlayHint":
+		var request lsp.InlayHintRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/inlayHint %s", err)
+		}
+
+		response := state.InlayHints(request.ID, request.Params.TextDocument.URI, request.Params.Range, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/codeAction":
+		var request lsp.CodeActionRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/codeAction %s", err)
+		}
+
+		response := state.CodeActions(request.ID, request.Params, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/formatting":
+		var request lsp.DocumentFormattingRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/formatting %s", err)
+		}
+
+		response := state.Formatting(request.ID, request.Params.TextDocument.URI, nil, request.Params.Options, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/rangeFormatting":
+		var request lsp.DocumentRangeFormattingRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/rangeFormatting %s", err)
+		}
+
+		response := state.Formatting(request.ID, request.Params.TextDocument.URI, &request.Params.Range, request.Params.Options, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/references":
+		var request lsp.ReferencesRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/references %s", err)
 		}
 
+		response := state.References(request.ID, request.Params.TextDocument.URI, request.Params.Position, request.Params.Context.IncludeDeclaration, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/rename":
+		var request lsp.RenameRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/rename %s", err)
+		}
+
+		response := state.Rename(request.ID, request.Params.TextDocument.URI, request.Params.Position, request.Params.NewName, logger)
+		writeResponse(writer, response)
+
+	case "textDocument/diagnostic":
+		var request lsp.DocumentDiagnosticRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("textDocument/diagnostic %s", err)
+		}
+
+		response := state.DocumentDiagnostics(request.ID, request.Params.TextDocument.URI, request.Params.PreviousResultID, logger)
+		writeResponse(writer, response)
+
+	case "workspace/diagnostic":
+		var request lsp.WorkspaceDiagnosticRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("workspace/diagnostic %s", err)
+		}
+
+		response := state.WorkspaceDiagnostics(request.ID, request.Params.PreviousResultIDs, logger)
+		writeResponse(writer, response)
+
+	case "workspace/symbol":
+		var request lsp.WorkspaceSymbolRequest
+		if err := json.Unmarshal(contents, &request); err != nil {
+			logger.Printf("workspace/symbol %s", err)
+		}
+
+		response := state.WorkspaceSymbols(request.ID, request.Params.Query, logger)
+		writeResponse(writer, response)
+
 	case "shutdown":
 		keys := maps.Keys(state.Documents)
 		filePath := analysis.GetTempPath()